@@ -0,0 +1,161 @@
+package cli
+
+import (
+	"compareapp/diff"
+	"compareapp/helm"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"helm.sh/helm/v3/pkg/cli/values"
+	"sigs.k8s.io/yaml"
+)
+
+type chartOptions struct {
+	chart      string
+	values     string
+	set        repeatedFlag
+	setString  repeatedFlag
+	release    string
+	namespace  string
+	kubeconfig string
+	cluster    string
+	output     string
+	config     string
+	timeout    time.Duration
+}
+
+// repeatedFlag collects every value of the flag, like helm --set
+type repeatedFlag []string
+
+func (f *repeatedFlag) String() string { return strings.Join(*f, ",") }
+
+func (f *repeatedFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// runChartDiff renders local chart and compares it with the deployed release:
+// exit code is ExitDrift when upgrade changes anything
+func runChartDiff(args []string, stdout, stderr io.Writer) int {
+	var opts chartOptions
+	fs := flag.NewFlagSet("chart-diff", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&opts.chart, "chart", "", "chart directory or .tgz (required)")
+	fs.StringVar(&opts.values, "values", "", "comma separated values files, like helm -f")
+	fs.Var(&opts.set, "set", "values like helm --set key1=val1,key2=val2, can be repeated")
+	fs.Var(&opts.setString, "set-string", "string values like helm --set-string, can be repeated")
+	fs.StringVar(&opts.release, "release", "", "name of the deployed release (required)")
+	fs.StringVar(&opts.namespace, "namespace", "", "namespace of the release (required)")
+	fs.StringVar(&opts.kubeconfig, "kubeconfig", defaultKubeconfig(), "kubeconfig of the cluster")
+	fs.StringVar(&opts.cluster, "cluster", "", "context of the cluster, current context by default")
+	fs.StringVar(&opts.output, "output", "table", "output format: table, json or yaml")
+	fs.StringVar(&opts.config, "config", "./conf/config.json", "config with kube_* and clusters settings, skipped when missing")
+	fs.DurationVar(&opts.timeout, "timeout", 2*time.Minute, "timeout of reading the release")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitOK
+		}
+		return ExitUsage
+	}
+
+	switch {
+	case opts.chart == "" || opts.release == "" || opts.namespace == "":
+		fmt.Fprintln(stderr, "error: --chart, --release and --namespace are required")
+		return ExitUsage
+	case opts.output != "table" && opts.output != "json" && opts.output != "yaml":
+		fmt.Fprintf(stderr, "error: unknown output %q, expected table, json or yaml\n", opts.output)
+		return ExitUsage
+	}
+	if err := loadConfig(opts.config); err != nil {
+		fmt.Fprintln(stderr, "error:", err)
+		return ExitUsage
+	}
+	cluster, err := resolveContext(opts.cluster, opts.kubeconfig)
+	if err != nil {
+		fmt.Fprintln(stderr, "error:", err)
+		return ExitUsage
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+	deployed, err := helm.GetRelease(ctx, cluster, opts.kubeconfig, opts.namespace, opts.release, 0)
+	if err != nil {
+		fmt.Fprintln(stderr, "error:", err)
+		return ExitReadFailed
+	}
+	// the chart is rendered with .Capabilities of the cluster the release is upgraded in
+	caps, err := helm.ClusterCapabilities(ctx, cluster, opts.kubeconfig)
+	if err != nil {
+		fmt.Fprintln(stderr, "error:", err)
+		return ExitReadFailed
+	}
+	valueOpts := &values.Options{
+		ValueFiles:   splitList(opts.values),
+		Values:       opts.set,
+		StringValues: opts.setString,
+	}
+	rendered, err := helm.RenderChart(opts.chart, valueOpts, opts.release, opts.namespace, caps)
+	if err != nil {
+		fmt.Fprintln(stderr, "error:", err)
+		return ExitUsage
+	}
+
+	result := diff.CompareChart(cluster, deployed, rendered)
+	if err := writeChartDiff(stdout, opts.output, result); err != nil {
+		fmt.Fprintln(stderr, "error:", err)
+		return ExitUsage
+	}
+	if result.Empty() {
+		return ExitOK
+	}
+	return ExitDrift
+}
+
+func writeChartDiff(w io.Writer, output string, d diff.ChartDiff) error {
+	switch output {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(d)
+	case "yaml":
+		data, err := yaml.Marshal(d)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+
+	fmt.Fprintf(w, "release %s/%s in %s: %s (revision %d) -> %s\n", d.Namespace, d.Release, d.Cluster, d.Deployed, d.Revision, d.Chart)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "OBJECT\tCHANGE\n")
+	for _, name := range d.Added {
+		fmt.Fprintf(tw, "%s\tcreated\n", name)
+	}
+	for _, name := range d.Removed {
+		fmt.Fprintf(tw, "%s\tdeleted\n", name)
+	}
+	for _, r := range d.Changed {
+		for _, change := range r.Changes {
+			fmt.Fprintf(tw, "%s\t%s: %s -> %s\n", r.Name, change.PathString(),
+				changeValue(change.Value1, change.In1), changeValue(change.Value2, change.In2))
+		}
+	}
+	for _, change := range d.Values {
+		fmt.Fprintf(tw, "values\t%s: %s -> %s\n", change.PathString(),
+			changeValue(change.Value1, change.In1), changeValue(change.Value2, change.In2))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\n%d objects created, %d deleted, %d changed, %d values changed\n",
+		len(d.Added), len(d.Removed), len(d.Changed), len(d.Values))
+	return err
+}
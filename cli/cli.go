@@ -0,0 +1,312 @@
+// Package cli is the headless mode for CI drift checks:
+//
+//	compareapp diff --cluster-a stage --ns-a foo --cluster-b prod --ns-b foo --kinds deployments,services --output table
+//
+// Exit code tells whether drift was found, so a pipeline job fails when clusters diverge.
+package cli
+
+import (
+	"compareapp/diff"
+	"compareapp/k8s"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// exit codes of the diff command
+const (
+	ExitOK         = 0 // no drift
+	ExitDrift      = 1 // objects differ or are missing on one side
+	ExitUsage      = 2 // wrong flags or config
+	ExitReadFailed = 3 // some objects could not be read, the result is incomplete
+)
+
+// IsCommand is true when main must run the cli instead of the web server
+func IsCommand(args []string) bool {
+	return len(args) > 0 && args[0] != "serve"
+}
+
+// Run runs the command and returns the process exit code
+func Run(args []string, stdout, stderr io.Writer) int {
+	switch args[0] {
+	case "diff":
+		return runDiff(args[1:], stdout, stderr)
+	case "snapshot":
+		return runSnapshot(args[1:], stdout, stderr)
+	case "chart-diff":
+		return runChartDiff(args[1:], stdout, stderr)
+	case "help", "-h", "--help":
+		usage(stdout)
+		return ExitOK
+	}
+	fmt.Fprintf(stderr, "unknown command %q\n\n", args[0])
+	usage(stderr)
+	return ExitUsage
+}
+
+func usage(w io.Writer) {
+	fmt.Fprint(w, `Usage:
+  compareapp [serve]      start the web server
+  compareapp diff [flags] compare two clusters and exit with 0 (no drift), 1 (drift found),
+                          2 (wrong flags or config) or 3 (some objects could not be read)
+  compareapp snapshot [flags]
+                          save objects of a cluster to directory or .tar.gz, the snapshot
+                          can be compared instead of the cluster (--snapshot-a, --snapshot-b)
+  compareapp chart-diff [flags]
+                          render local chart and show what upgrade of the deployed release
+                          changes, exit code 1 when the upgrade changes anything
+
+Run "compareapp <command> -h" for flags of the command.
+`)
+}
+
+// engine settings of conf/config.json used by the cli, the rest is for the web server
+type fileConfig struct {
+	KubeQPS          float32                           `json:"kube_qps"`
+	KubeBurst        int                               `json:"kube_burst"`
+	KubeTimeout      int                               `json:"kube_timeout"`
+	KubeParallelism  int                               `json:"kube_parallelism"`
+	NamespaceMapping map[string]string                 `json:"namespace_mapping"`
+	IgnoreRules      map[string][]diff.IgnoreRule      `json:"ignore_rules"`
+	Clusters         map[string]k8s.ClusterSettings    `json:"clusters"`
+	SecretKey        string                            `json:"secret_fingerprint_key"`
+	HostnameRewrites map[string][]diff.HostnameRewrite `json:"hostname_rewrites"`
+}
+
+type diffOptions struct {
+	kubeconfigA, kubeconfigB string
+	clusterA, clusterB       string
+	snapshotA, snapshotB     string
+	manifestsA, manifestsB   string
+	namespacesA, namespacesB string
+	namespaceMapping         string
+	kinds                    string
+	output                   string
+	config                   string
+	timeout                  time.Duration
+}
+
+func runDiff(args []string, stdout, stderr io.Writer) int {
+	var opts diffOptions
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&opts.kubeconfigA, "kubeconfig", defaultKubeconfig(), "kubeconfig of cluster A (and B when --kubeconfig-b is not set)")
+	fs.StringVar(&opts.kubeconfigB, "kubeconfig-b", "", "kubeconfig of cluster B")
+	fs.StringVar(&opts.clusterA, "cluster-a", "", "context of cluster A, current context by default")
+	fs.StringVar(&opts.clusterB, "cluster-b", "", "context of cluster B, current context by default")
+	fs.StringVar(&opts.snapshotA, "snapshot-a", "", "snapshot directory or .tar.gz compared instead of cluster A")
+	fs.StringVar(&opts.snapshotB, "snapshot-b", "", "snapshot directory or .tar.gz compared instead of cluster B")
+	fs.StringVar(&opts.manifestsA, "manifests-a", "", "directory of YAML/JSON manifests (desired state) compared instead of cluster A")
+	fs.StringVar(&opts.manifestsB, "manifests-b", "", "directory of YAML/JSON manifests (desired state) compared instead of cluster B")
+	fs.StringVar(&opts.namespacesA, "ns-a", "", "comma separated namespaces of cluster A (required)")
+	fs.StringVar(&opts.namespacesB, "ns-b", "", "comma separated namespaces of cluster B, the same as --ns-a by default")
+	fs.StringVar(&opts.namespaceMapping, "ns-map", "", "comma separated namespace mapping like foo-stage=foo")
+	fs.StringVar(&opts.kinds, "kinds", "", "comma separated kinds to compare, all except *-all kinds by default ("+strings.Join(kindIDs(), ",")+")")
+	fs.StringVar(&opts.output, "output", "table", "output format: table, json or yaml")
+	fs.StringVar(&opts.config, "config", "./conf/config.json", "config with ignore_rules, namespace_mapping, clusters and kube_* settings, skipped when missing")
+	fs.DurationVar(&opts.timeout, "timeout", 2*time.Minute, "timeout of the whole comparison")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitOK
+		}
+		return ExitUsage
+	}
+
+	report, err := prepareDiff(opts)
+	if err != nil {
+		fmt.Fprintln(stderr, "error:", err)
+		return ExitUsage
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+	for _, kind := range report.kinds {
+		result, err := diff.Compare(ctx, kind, report.sides)
+		if err != nil {
+			fmt.Fprintln(stderr, "error:", err)
+			return ExitReadFailed
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	if err := writeReport(stdout, opts.output, report); err != nil {
+		fmt.Fprintln(stderr, "error:", err)
+		return ExitUsage
+	}
+	return report.exitCode()
+}
+
+// prepareDiff checks flags and config and resolves kinds and comparison sides
+func prepareDiff(opts diffOptions) (*report, error) {
+	switch opts.output {
+	case "table", "json", "yaml":
+	default:
+		return nil, fmt.Errorf("unknown output %q, expected table, json or yaml", opts.output)
+	}
+	if err := loadConfig(opts.config); err != nil {
+		return nil, err
+	}
+
+	if opts.kubeconfigB == "" {
+		opts.kubeconfigB = opts.kubeconfigA
+	}
+	clusterA, kubeconfigA, err := resolveSide(opts.clusterA, opts.kubeconfigA, opts.snapshotA, opts.manifestsA)
+	if err != nil {
+		return nil, err
+	}
+	clusterB, kubeconfigB, err := resolveSide(opts.clusterB, opts.kubeconfigB, opts.snapshotB, opts.manifestsB)
+	if err != nil {
+		return nil, err
+	}
+
+	namespacesA := splitList(opts.namespacesA)
+	if len(namespacesA) == 0 {
+		return nil, fmt.Errorf("--ns-a is required")
+	}
+	namespacesB := splitList(opts.namespacesB)
+	if len(namespacesB) == 0 {
+		namespacesB = namespacesA
+	}
+	mapping, err := diff.ParseNamespaceMapping(strings.ReplaceAll(opts.namespaceMapping, ",", "\n"))
+	if err != nil {
+		return nil, err
+	}
+
+	r := &report{Cluster1: clusterA, Cluster2: clusterB}
+	r.NamespacePairs = diff.PairNamespaces(namespacesA, namespacesB, mapping)
+	for _, pair := range r.NamespacePairs {
+		side1, side2 := pair.Sides(clusterA, kubeconfigA, clusterB, kubeconfigB)
+		r.sides = append(r.sides, [2]diff.Side{side1, side2})
+	}
+
+	if r.kinds, err = parseKinds(opts.kinds); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseKinds returns kinds by comma separated ids, all kinds for empty list
+func parseKinds(ids string) ([]diff.Kind, error) {
+	if ids == "" {
+		return diff.DefaultKinds(), nil
+	}
+	var kinds []diff.Kind
+	for _, id := range splitList(ids) {
+		kind, ok := diff.KindByID(id)
+		if !ok {
+			return nil, fmt.Errorf("unknown kind %q, expected one of %s", id, strings.Join(kindIDs(), ","))
+		}
+		kinds = append(kinds, kind)
+	}
+	return kinds, nil
+}
+
+// loadConfig applies engine settings of the web server config, missing config is fine
+func loadConfig(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var config fileConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	k8s.SetClientSettings(k8s.ClientSettings{
+		QPS:         config.KubeQPS,
+		Burst:       config.KubeBurst,
+		Timeout:     time.Duration(config.KubeTimeout) * time.Second,
+		Parallelism: config.KubeParallelism,
+	})
+	diff.SetNamespaceMapping(config.NamespaceMapping)
+	diff.SetSecretKey(config.SecretKey)
+	if err := k8s.SetClusterSettings(config.Clusters); err != nil {
+		return err
+	}
+	if err := diff.SetHostnameRewrites(config.HostnameRewrites); err != nil {
+		return err
+	}
+	return diff.SetIgnoreRules(config.IgnoreRules)
+}
+
+// resolveSide returns cluster name and kubeconfig of the comparison side, snapshot
+// or manifests are used instead of the cluster when given
+func resolveSide(contextName, kubeconfig, snapshot, manifestDir string) (string, string, error) {
+	if snapshot != "" && manifestDir != "" {
+		return "", "", fmt.Errorf("snapshot and manifests can not be compared on the same side")
+	}
+	if manifestDir != "" {
+		configPath := k8s.ManifestsConfigPath(manifestDir)
+		if _, err := k8s.OpenManifests(configPath); err != nil {
+			return "", "", err
+		}
+		return "manifests:" + filepath.Base(filepath.Clean(manifestDir)), configPath, nil
+	}
+	if snapshot != "" {
+		configPath := k8s.SnapshotConfigPath(snapshot)
+		if _, err := k8s.OpenSnapshot(configPath); err != nil {
+			return "", "", err
+		}
+		return snapshotLabel(snapshot), configPath, nil
+	}
+	contextName, err := resolveContext(contextName, kubeconfig)
+	return contextName, kubeconfig, err
+}
+
+// snapshotLabel is the cluster name of the snapshot side, the same as in the web cluster picker
+func snapshotLabel(snapshot string) string {
+	name := filepath.Base(filepath.Clean(snapshot))
+	for _, ext := range []string{".tar.gz", ".tgz"} {
+		name = strings.TrimSuffix(name, ext)
+	}
+	return "snapshot:" + name
+}
+
+// resolveContext checks the context and returns current context of kubeconfig for empty name
+func resolveContext(contextName, kubeconfig string) (string, error) {
+	if contextName == "" {
+		return k8s.CurrentContext(kubeconfig)
+	}
+	if _, err := k8s.RESTConfig(contextName, kubeconfig); err != nil {
+		return "", err
+	}
+	return contextName, nil
+}
+
+func defaultKubeconfig() string {
+	if path := os.Getenv("KUBECONFIG"); path != "" {
+		return strings.Split(path, string(os.PathListSeparator))[0]
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".kube", "config")
+}
+
+func kindIDs() []string {
+	var ids []string
+	for _, kind := range diff.Kinds() {
+		ids = append(ids, kind.ID)
+	}
+	return ids
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,168 @@
+package cli
+
+import (
+	"compareapp/diff"
+	"compareapp/k8s"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"sigs.k8s.io/yaml"
+)
+
+// report is the output of the diff command, json and yaml have the same
+// fields as the response of POST /api/v1/compare plus the drift summary
+type report struct {
+	Cluster1       string               `json:"cluster1"`
+	Cluster2       string               `json:"cluster2"`
+	NamespacePairs []diff.NamespacePair `json:"namespacePairs"`
+	Results        []diff.Result        `json:"results"`
+	Summary        summary              `json:"summary"`
+
+	kinds []diff.Kind
+	sides [][2]diff.Side
+}
+
+type summary struct {
+	Drift      bool `json:"drift"`
+	Missing    int  `json:"missing"`    // objects present on one side only
+	Different  int  `json:"different"`  // objects with different specs
+	ReadFailed int  `json:"readFailed"` // sides which could not be read
+	// Incomparable objects differ only by secret fingerprints made with different
+	// keys, it is not drift: the values can't be compared at all
+	Incomparable int `json:"incomparable"`
+}
+
+func (r *report) summarize() {
+	r.Summary = summary{}
+	for _, result := range r.Results {
+		for _, pair := range result.Pairs {
+			r.Summary.Missing += len(pair.Only1) + len(pair.Only2)
+			for _, d := range pair.Diffs {
+				if onlyIncomparable(d.Changes) {
+					r.Summary.Incomparable++
+				} else {
+					r.Summary.Different++
+				}
+			}
+			for _, status := range pair.Statuses {
+				switch status.Reason() {
+				case k8s.ReasonNotInstalled, k8s.ReasonNotInManifests:
+				default:
+					r.Summary.ReadFailed++
+				}
+			}
+			// CRD missing on one side only: its objects on the other side are missing
+			if len(pair.Statuses) == 1 && pair.Statuses[0].Reason() == k8s.ReasonNotInstalled {
+				r.Summary.Missing += len(pair.Objects1) + len(pair.Objects2)
+			}
+		}
+	}
+	r.Summary.Drift = r.Summary.Missing > 0 || r.Summary.Different > 0
+}
+
+// onlyIncomparable is true when every change is a pair of incomparable fingerprints
+func onlyIncomparable(changes []diff.Change) bool {
+	for _, change := range changes {
+		if !change.Incomparable {
+			return false
+		}
+	}
+	return len(changes) > 0
+}
+
+// exitCode prefers read errors over drift: incomplete result must not pass as clean
+func (r *report) exitCode() int {
+	switch {
+	case r.Summary.ReadFailed > 0:
+		return ExitReadFailed
+	case r.Summary.Drift:
+		return ExitDrift
+	}
+	return ExitOK
+}
+
+func writeReport(w io.Writer, output string, r *report) error {
+	r.summarize()
+	switch output {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r)
+	case "yaml":
+		data, err := yaml.Marshal(r)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+	return writeTable(w, r)
+}
+
+// writeTable prints one line per missing object, changed field or failed side
+func writeTable(w io.Writer, r *report) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "KIND\tNAMESPACES\tNAME\tDRIFT\n")
+	for _, result := range r.Results {
+		for _, pair := range result.Pairs {
+			namespaces := pair.Side1.Namespace + " -> " + pair.Side2.Namespace
+			for _, status := range pair.Statuses {
+				if status.Reason() == k8s.ReasonNotInstalled && len(pair.Objects1)+len(pair.Objects2) == 0 {
+					continue // not installed anywhere, nothing to compare
+				}
+				if status.Reason() == k8s.ReasonNotInManifests {
+					continue // helm values can not be compared with manifests
+				}
+				fmt.Fprintf(tw, "%s\t%s\t\t%s\n", result.Name, namespaces, status.Message())
+			}
+			for _, name := range pair.Only1 {
+				fmt.Fprintf(tw, "%s\t%s\t%s\tonly in %s\n", result.Name, namespaces, name, r.Cluster1)
+			}
+			for _, name := range pair.Only2 {
+				fmt.Fprintf(tw, "%s\t%s\t%s\tonly in %s\n", result.Name, namespaces, name, r.Cluster2)
+			}
+			for _, d := range pair.Diffs {
+				for _, change := range d.Changes {
+					if change.Incomparable {
+						fmt.Fprintf(tw, "%s\t%s\t%s\t%s: fingerprints not comparable (different secret_fingerprint_key)\n", result.Name, namespaces, d.Name, change.PathString())
+						continue
+					}
+					fmt.Fprintf(tw, "%s\t%s\t%s\t%s: %s -> %s\n", result.Name, namespaces, d.Name,
+						change.PathString(), changeValue(change.Value1, change.In1), changeValue(change.Value2, change.In2))
+				}
+			}
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	s := r.Summary
+	if !s.Drift && s.ReadFailed == 0 {
+		if s.Incomparable > 0 {
+			_, err := fmt.Fprintf(w, "\nno drift between %s and %s, %d not comparable\n", r.Cluster1, r.Cluster2, s.Incomparable)
+			return err
+		}
+		_, err := fmt.Fprintf(w, "\nno drift between %s and %s\n", r.Cluster1, r.Cluster2)
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\n%d missing, %d different, %d not comparable, %d could not be read\n", s.Missing, s.Different, s.Incomparable, s.ReadFailed)
+	return err
+}
+
+// changeValue prints the value as compact json, long values are cut
+func changeValue(v interface{}, present bool) string {
+	if !present {
+		return "<none>"
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	if len(data) > 80 {
+		return string(data[:77]) + "..."
+	}
+	return string(data)
+}
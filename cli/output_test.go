@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"compareapp/diff"
+	"compareapp/k8s"
+	"testing"
+)
+
+func reportOf(pairs ...diff.PairResult) *report {
+	return &report{Cluster1: "stage", Cluster2: "prod", Results: []diff.Result{{Kind: "secrets", Name: "Secrets", Pairs: pairs}}}
+}
+
+func TestSummarizeIncomparable(t *testing.T) {
+	incomparable := diff.Change{Path: []string{"data", "password"}, In1: true, In2: true, Incomparable: true}
+	different := diff.Change{Path: []string{"type"}, Value1: "Opaque", Value2: "kubernetes.io/tls", In1: true, In2: true}
+	tests := []struct {
+		name             string
+		changes          []diff.Change
+		wantDifferent    int
+		wantIncomparable int
+		wantExit         int
+	}{
+		{"only incomparable", []diff.Change{incomparable}, 0, 1, ExitOK},
+		{"incomparable and different", []diff.Change{incomparable, different}, 1, 0, ExitDrift},
+		{"different", []diff.Change{different}, 1, 0, ExitDrift},
+	}
+	for _, tt := range tests {
+		r := reportOf(diff.PairResult{Diffs: []diff.ResourceDiff{{Name: "db", Changes: tt.changes}}})
+		r.summarize()
+		if r.Summary.Different != tt.wantDifferent || r.Summary.Incomparable != tt.wantIncomparable {
+			t.Errorf("%s: summary = %+v, want %d different and %d incomparable", tt.name, r.Summary, tt.wantDifferent, tt.wantIncomparable)
+		}
+		if got := r.exitCode(); got != tt.wantExit {
+			t.Errorf("%s: exitCode() = %d, want %d", tt.name, got, tt.wantExit)
+		}
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	failed := func(index int, reason k8s.Reason) diff.Status {
+		return diff.Status{Kind: "Canaries", Index: index, Err: &k8s.APIError{Reason: reason, Cluster: "prod", Resource: "canaries"}}
+	}
+	changed := []diff.ResourceDiff{{Name: "api", Changes: []diff.Change{{Path: []string{"replicas"}, Value1: int64(2), Value2: int64(3), In1: true, In2: true}}}}
+	tests := []struct {
+		name        string
+		pair        diff.PairResult
+		wantMissing int
+		want        int
+	}{
+		{"no drift", diff.PairResult{Objects1: []string{"api"}, Objects2: []string{"api"}}, 0, ExitOK},
+		{"missing", diff.PairResult{Objects1: []string{"api", "worker"}, Objects2: []string{"api"}, Only1: []string{"worker"}}, 1, ExitDrift},
+		{"different", diff.PairResult{Objects1: []string{"api"}, Objects2: []string{"api"}, Diffs: changed}, 0, ExitDrift},
+		{"read failed beats drift", diff.PairResult{Only2: []string{"worker"}, Statuses: []diff.Status{failed(0, k8s.ReasonForbidden)}}, 1, ExitReadFailed},
+		{"both sides failed", diff.PairResult{Statuses: []diff.Status{failed(0, k8s.ReasonTimeout), failed(1, k8s.ReasonTimeout)}}, 0, ExitReadFailed},
+		{"CRD on one side only", diff.PairResult{Objects1: []string{"api", "worker"}, Statuses: []diff.Status{failed(1, k8s.ReasonNotInstalled)}}, 2, ExitDrift},
+		{"CRD on neither side", diff.PairResult{Statuses: []diff.Status{failed(0, k8s.ReasonNotInstalled), failed(1, k8s.ReasonNotInstalled)}}, 0, ExitOK},
+		{"kind not in manifests", diff.PairResult{Statuses: []diff.Status{failed(0, k8s.ReasonNotInManifests)}}, 0, ExitOK},
+	}
+	for _, tt := range tests {
+		r := reportOf(tt.pair)
+		r.summarize()
+		if r.Summary.Missing != tt.wantMissing {
+			t.Errorf("%s: missing = %d, want %d", tt.name, r.Summary.Missing, tt.wantMissing)
+		}
+		if got := r.exitCode(); got != tt.want {
+			t.Errorf("%s: exitCode() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"compareapp/diff"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+type snapshotOptions struct {
+	kubeconfig string
+	cluster    string
+	namespaces string
+	kinds      string
+	out        string
+	config     string
+	timeout    time.Duration
+}
+
+// runSnapshot saves objects of the cluster, exit code is ExitReadFailed when
+// some objects could not be read (the snapshot is written anyway)
+func runSnapshot(args []string, stdout, stderr io.Writer) int {
+	var opts snapshotOptions
+	fs := flag.NewFlagSet("snapshot", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&opts.kubeconfig, "kubeconfig", defaultKubeconfig(), "kubeconfig of the cluster")
+	fs.StringVar(&opts.cluster, "cluster", "", "context of the cluster, current context by default")
+	fs.StringVar(&opts.namespaces, "ns", "", "comma separated namespaces, all namespaces by default")
+	fs.StringVar(&opts.kinds, "kinds", "", "comma separated kinds to save, all by default ("+strings.Join(kindIDs(), ",")+")")
+	fs.StringVar(&opts.out, "out", "", "snapshot directory or file ending with .tar.gz (required)")
+	fs.StringVar(&opts.config, "config", "./conf/config.json", "config with kube_* and clusters settings, skipped when missing")
+	fs.DurationVar(&opts.timeout, "timeout", 5*time.Minute, "timeout of the whole capture")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitOK
+		}
+		return ExitUsage
+	}
+
+	if opts.out == "" {
+		fmt.Fprintln(stderr, "error: --out is required")
+		return ExitUsage
+	}
+	if err := loadConfig(opts.config); err != nil {
+		fmt.Fprintln(stderr, "error:", err)
+		return ExitUsage
+	}
+	cluster, err := resolveContext(opts.cluster, opts.kubeconfig)
+	if err != nil {
+		fmt.Fprintln(stderr, "error:", err)
+		return ExitUsage
+	}
+	kinds, err := parseKinds(opts.kinds)
+	if err != nil {
+		fmt.Fprintln(stderr, "error:", err)
+		return ExitUsage
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+	manifest, statuses, err := diff.Capture(ctx, cluster, opts.kubeconfig, splitList(opts.namespaces), kinds, opts.out)
+	if err != nil {
+		fmt.Fprintln(stderr, "error:", err)
+		return ExitReadFailed
+	}
+	for _, status := range statuses {
+		fmt.Fprintln(stderr, "warning:", status.Message())
+	}
+	fmt.Fprintf(stdout, "snapshot of %s (%s) saved to %s: %d namespaces, %d resources\n",
+		manifest.Cluster, manifest.KubernetesVersion, opts.out, len(manifest.Namespaces), len(manifest.Resources))
+	if len(statuses) > 0 {
+		return ExitReadFailed
+	}
+	return ExitOK
+}
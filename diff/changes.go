@@ -0,0 +1,260 @@
+package diff
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// listMergeKeys are the natural merge keys of list fields, elements of these
+// lists are matched by key instead of comparing the whole list. Candidates are
+// tried in order, the first one present and unique in all elements is used.
+// Keys of nested fields are dotted ("metadata.name").
+var listMergeKeys = map[string][]string{
+	"containers":          {"name"},
+	"initContainers":      {"name"},
+	"ephemeralContainers": {"name"},
+	"env":                 {"name"},
+	"ports":               {"containerPort", "name", "port"},
+	"volumes":             {"name"},
+	"volumeMounts":        {"mountPath"},
+	"routes":              {"match"},
+	// claim templates of statefulsets are objects with names
+	"volumeClaimTemplates": {"metadata.name"},
+}
+
+// Change is one field which differs between two specs. List elements matched
+// by merge key are written in Path as "[key]" segments.
+type Change struct {
+	Path   []string    `json:"path"`
+	Value1 interface{} `json:"value1"`
+	Value2 interface{} `json:"value2"`
+	In1    bool        `json:"in1"`
+	In2    bool        `json:"in2"`
+	// TextDiff is unified diff of multi-line text values (config files in ConfigMaps)
+	TextDiff string `json:"textDiff,omitempty"`
+	// Incomparable values are secret fingerprints made with different keys, they
+	// may be equal or not
+	Incomparable bool `json:"incomparable,omitempty"`
+}
+
+// PathString returns path like "template.spec.containers[app].env[LOG_LEVEL].value"
+func (c Change) PathString() string {
+	return joinPath(c.Path)
+}
+
+func joinPath(path []string) string {
+	var b strings.Builder
+	for i, segment := range path {
+		if i > 0 && !strings.HasPrefix(segment, "[") {
+			b.WriteString(".")
+		}
+		b.WriteString(segment)
+	}
+	return b.String()
+}
+
+// Changes returns all differing fields of two specs
+func Changes(spec1, spec2 interface{}) []Change {
+	var changes []Change
+	compareValues(nil, "", spec1, spec2, &changes)
+	return changes
+}
+
+func compareValues(path []string, field string, v1, v2 interface{}, changes *[]Change) {
+	if reflect.DeepEqual(v1, v2) {
+		return
+	}
+
+	map1, ok1 := v1.(map[string]interface{})
+	map2, ok2 := v2.(map[string]interface{})
+	if ok1 && ok2 {
+		for _, k := range unionKeys(map1, map2) {
+			item1, in1 := map1[k]
+			item2, in2 := map2[k]
+			childPath := appendPath(path, k)
+			if in1 && in2 {
+				compareValues(childPath, k, item1, item2, changes)
+			} else {
+				*changes = append(*changes, Change{Path: childPath, Value1: item1, Value2: item2, In1: in1, In2: in2})
+			}
+		}
+		return
+	}
+
+	list1, ok1 := v1.([]interface{})
+	list2, ok2 := v2.([]interface{})
+	if ok1 && ok2 {
+		if key := mergeKey(field, list1, list2); key != "" {
+			compareKeyedLists(path, key, list1, list2, changes)
+			return
+		}
+	}
+
+	*changes = append(*changes, Change{Path: path, Value1: v1, Value2: v2, In1: true, In2: true, TextDiff: textDiff(v1, v2),
+		Incomparable: fingerprintsIncomparable(v1, v2)})
+}
+
+// textDiff returns unified diff of two strings when any of them has several lines
+func textDiff(v1, v2 interface{}) string {
+	text1, ok1 := v1.(string)
+	text2, ok2 := v2.(string)
+	if !ok1 || !ok2 || !(strings.Contains(text1, "\n") || strings.Contains(text2, "\n")) {
+		return ""
+	}
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(text1),
+		B:        difflib.SplitLines(text2),
+		FromFile: "value1",
+		ToFile:   "value2",
+		Context:  3,
+	})
+	if err != nil {
+		return ""
+	}
+	return diff
+}
+
+func compareKeyedLists(path []string, key string, list1, list2 []interface{}, changes *[]Change) {
+	items2 := make(map[string]interface{}, len(list2))
+	for _, item := range list2 {
+		items2[itemKey(item, key)] = item
+	}
+	seen := make(map[string]bool, len(list1))
+	for _, item1 := range list1 {
+		k := itemKey(item1, key)
+		seen[k] = true
+		itemPath := appendPath(path, "["+k+"]")
+		if item2, ok := items2[k]; ok {
+			compareValues(itemPath, "", item1, item2, changes)
+		} else {
+			*changes = append(*changes, Change{Path: itemPath, Value1: item1, In1: true})
+		}
+	}
+	for _, item2 := range list2 {
+		k := itemKey(item2, key)
+		if !seen[k] {
+			*changes = append(*changes, Change{Path: appendPath(path, "["+k+"]"), Value2: item2, In2: true})
+		}
+	}
+}
+
+// mergeKey returns key for matching elements of the list field, empty when the
+// field has no merge key or elements can't be matched by it
+func mergeKey(field string, list1, list2 []interface{}) string {
+	for _, key := range listMergeKeys[field] {
+		if uniqueKey(list1, key) && uniqueKey(list2, key) {
+			return key
+		}
+	}
+	return ""
+}
+
+func uniqueKey(list []interface{}, key string) bool {
+	seen := make(map[string]bool, len(list))
+	for _, item := range list {
+		value, ok := keyValue(item, key)
+		if !ok {
+			return false
+		}
+		k := fmt.Sprint(value)
+		if seen[k] {
+			return false
+		}
+		seen[k] = true
+	}
+	return true
+}
+
+func itemKey(item interface{}, key string) string {
+	value, _ := keyValue(item, key)
+	return fmt.Sprint(value)
+}
+
+// keyValue returns value of the merge key of the list element, nested for dotted keys
+func keyValue(item interface{}, key string) (interface{}, bool) {
+	value := item
+	for _, field := range strings.Split(key, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = m[field]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+func unionKeys(map1, map2 map[string]interface{}) []string {
+	keys := make([]string, 0, len(map1)+len(map2))
+	for k := range map1 {
+		keys = append(keys, k)
+	}
+	for k := range map2 {
+		if _, ok := map1[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func appendPath(path []string, segment string) []string {
+	p := make([]string, len(path), len(path)+1)
+	copy(p, path)
+	return append(p, segment)
+}
+
+// nestedDiff builds the difference map shown on report pages: field present in
+// one spec only is shown as is, different values as {"spec1": ..., "spec2": ...}.
+// Matched list elements are shown under "containers[app]" like keys.
+func nestedDiff(changes []Change) map[string]interface{} {
+	diff := make(map[string]interface{})
+	for _, c := range changes {
+		var leaf interface{}
+		if c.In1 && c.In2 {
+			leaf = map[string]interface{}{"spec1": c.Value1, "spec2": c.Value2}
+		} else if c.In1 {
+			leaf = c.Value1
+		} else {
+			leaf = c.Value2
+		}
+
+		keys := mergeListSegments(c.Path)
+		if len(keys) == 0 {
+			// specs are not maps, nothing to nest
+			if m, ok := leaf.(map[string]interface{}); ok {
+				return m
+			}
+			continue
+		}
+		node := diff
+		for _, k := range keys[:len(keys)-1] {
+			child, ok := node[k].(map[string]interface{})
+			if !ok {
+				child = make(map[string]interface{})
+				node[k] = child
+			}
+			node = child
+		}
+		node[keys[len(keys)-1]] = leaf
+	}
+	return diff
+}
+
+// mergeListSegments joins "[key]" segments with the list field name before them
+func mergeListSegments(path []string) []string {
+	var keys []string
+	for _, segment := range path {
+		if strings.HasPrefix(segment, "[") && len(keys) > 0 {
+			keys[len(keys)-1] += segment
+			continue
+		}
+		keys = append(keys, segment)
+	}
+	return keys
+}
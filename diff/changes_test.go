@@ -0,0 +1,109 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChangePathString(t *testing.T) {
+	tests := []struct {
+		path []string
+		want string
+	}{
+		{nil, ""},
+		{[]string{"replicas"}, "replicas"},
+		{[]string{"template", "spec", "containers", "[app]", "image"}, "template.spec.containers[app].image"},
+		{[]string{"containers", "[app]", "env", "[LOG_LEVEL]", "value"}, "containers[app].env[LOG_LEVEL].value"},
+		{[]string{"ports", "[8080]"}, "ports[8080]"},
+	}
+	for _, tt := range tests {
+		if got := (Change{Path: tt.path}).PathString(); got != tt.want {
+			t.Errorf("PathString(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func container(name, image string) map[string]interface{} {
+	return map[string]interface{}{"name": name, "image": image}
+}
+
+func claimTemplate(name, size string) map[string]interface{} {
+	return map[string]interface{}{
+		"metadata": map[string]interface{}{"name": name},
+		"spec":     map[string]interface{}{"size": size},
+	}
+}
+
+func TestChanges(t *testing.T) {
+	tests := []struct {
+		name         string
+		spec1, spec2 interface{}
+		want         []Change
+	}{
+		{
+			name:  "equal",
+			spec1: map[string]interface{}{"replicas": int64(2)},
+			spec2: map[string]interface{}{"replicas": int64(2)},
+		},
+		{
+			name:  "scalar",
+			spec1: map[string]interface{}{"replicas": int64(2)},
+			spec2: map[string]interface{}{"replicas": int64(3)},
+			want:  []Change{{Path: []string{"replicas"}, Value1: int64(2), Value2: int64(3), In1: true, In2: true}},
+		},
+		{
+			name:  "field in one spec",
+			spec1: map[string]interface{}{"paused": true},
+			spec2: map[string]interface{}{},
+			want:  []Change{{Path: []string{"paused"}, Value1: true, In1: true}},
+		},
+		{
+			name:  "containers matched by name in any order",
+			spec1: map[string]interface{}{"containers": []interface{}{container("app", "app:1"), container("proxy", "envoy")}},
+			spec2: map[string]interface{}{"containers": []interface{}{container("proxy", "envoy"), container("app", "app:2")}},
+			want:  []Change{{Path: []string{"containers", "[app]", "image"}, Value1: "app:1", Value2: "app:2", In1: true, In2: true}},
+		},
+		{
+			name:  "keyed element in one list",
+			spec1: map[string]interface{}{"containers": []interface{}{container("app", "app:1")}},
+			spec2: map[string]interface{}{"containers": []interface{}{container("app", "app:1"), container("proxy", "envoy")}},
+			want:  []Change{{Path: []string{"containers", "[proxy]"}, Value2: container("proxy", "envoy"), In2: true}},
+		},
+		{
+			name:  "duplicate keys compare whole list",
+			spec1: map[string]interface{}{"env": []interface{}{container("A", "1"), container("A", "2")}},
+			spec2: map[string]interface{}{"env": []interface{}{container("A", "1")}},
+			want: []Change{{
+				Path:   []string{"env"},
+				Value1: []interface{}{container("A", "1"), container("A", "2")},
+				Value2: []interface{}{container("A", "1")},
+				In1:    true, In2: true,
+			}},
+		},
+		{
+			name:  "nested merge key",
+			spec1: map[string]interface{}{"volumeClaimTemplates": []interface{}{claimTemplate("logs", "1Gi"), claimTemplate("data", "1Gi")}},
+			spec2: map[string]interface{}{"volumeClaimTemplates": []interface{}{claimTemplate("data", "2Gi"), claimTemplate("logs", "1Gi")}},
+			want:  []Change{{Path: []string{"volumeClaimTemplates", "[data]", "spec", "size"}, Value1: "1Gi", Value2: "2Gi", In1: true, In2: true}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Changes(tt.spec1, tt.spec2)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Changes() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChangesTextDiff(t *testing.T) {
+	changes := Changes(map[string]interface{}{"conf": "a\nb"}, map[string]interface{}{"conf": "a\nc"})
+	if len(changes) != 1 {
+		t.Fatalf("got %d changes, want 1", len(changes))
+	}
+	want := "--- value1\n+++ value2\n@@ -1,2 +1,2 @@\n a\n-b\n+c\n"
+	if changes[0].TextDiff != want {
+		t.Errorf("TextDiff = %q, want %q", changes[0].TextDiff, want)
+	}
+}
@@ -0,0 +1,103 @@
+package diff
+
+import (
+	"compareapp/helm"
+	"reflect"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// releaseObjects are objects of helm release manifests, they are matched by
+// kind and name and compared as a whole: both sides are rendered by helm, so
+// ignore rules of the registered kinds are not applied. Values of Secrets are
+// replaced with fingerprints.
+var releaseObjects = Kind{
+	ID:   "releaseobjects",
+	Name: "Release manifests",
+	NameOf: func(obj unstructured.Unstructured) string {
+		return obj.GetKind() + "/" + obj.GetName()
+	},
+	Normalize: normalizeReleaseObject,
+}
+
+// ReleaseChanges are differences of two renders of a release (deployed and
+// local chart, two revisions), Value1 of the changes is the older side
+type ReleaseChanges struct {
+	// Added are objects only in the newer side, Removed only in the older one
+	Added   []string       `json:"added"`
+	Removed []string       `json:"removed"`
+	Changed []ResourceDiff `json:"changed"`
+	Values  []Change       `json:"values"`
+}
+
+// ChartDiff is what upgrade of the deployed release to the locally rendered chart changes
+type ChartDiff struct {
+	Release   string `json:"release"`
+	Namespace string `json:"namespace"`
+	Cluster   string `json:"cluster"`
+	Chart     string `json:"chart"`    // local chart name-version
+	Deployed  string `json:"deployed"` // chart name-version of the release
+	Revision  int    `json:"revision"`
+	ReleaseChanges
+}
+
+// RevisionDiff is the difference of two revisions of a release, in one cluster or in two
+type RevisionDiff struct {
+	Release string       `json:"release"`
+	From    RevisionSide `json:"from"`
+	To      RevisionSide `json:"to"`
+	ReleaseChanges
+}
+
+// RevisionSide is the release revision compared on one side
+type RevisionSide struct {
+	Side
+	Chart    string `json:"chart"`
+	Revision int    `json:"revision"`
+}
+
+// CompareChart compares the deployed release with the chart rendered for upgrade
+func CompareChart(cluster string, deployed, rendered *helm.Rendered) ChartDiff {
+	return ChartDiff{
+		Release:        deployed.Name,
+		Namespace:      deployed.Namespace,
+		Cluster:        cluster,
+		Chart:          rendered.Chart,
+		Deployed:       deployed.Chart,
+		Revision:       deployed.Revision,
+		ReleaseChanges: compareRendered(Side{Cluster: cluster, Namespace: deployed.Namespace}, deployed, Side{Cluster: "rendered", Namespace: rendered.Namespace}, rendered),
+	}
+}
+
+// CompareRevisions compares two revisions of the release, sides can be the same cluster
+func CompareRevisions(side1 Side, from *helm.Rendered, side2 Side, to *helm.Rendered) RevisionDiff {
+	return RevisionDiff{
+		Release:        from.Name,
+		From:           RevisionSide{Side: side1, Chart: from.Chart, Revision: from.Revision},
+		To:             RevisionSide{Side: side2, Chart: to.Chart, Revision: to.Revision},
+		ReleaseChanges: compareRendered(side1, from, side2, to),
+	}
+}
+
+func compareRendered(side1 Side, older *helm.Rendered, side2 Side, newer *helm.Rendered) ReleaseChanges {
+	removed, added := GetDiff(Names(releaseObjects, older.Objects), Names(releaseObjects, newer.Objects))
+	sort.Strings(added)
+	sort.Strings(removed)
+
+	values := []Change{}
+	if !reflect.DeepEqual(older.Values, newer.Values) {
+		values = Changes(older.Values, newer.Values)
+	}
+	return ReleaseChanges{
+		Added:   added,
+		Removed: removed,
+		Changed: CompareObjects(releaseObjects, side1, older.Objects, side2, newer.Objects),
+		Values:  values,
+	}
+}
+
+// Empty is true when there is no difference
+func (c ReleaseChanges) Empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Changed) == 0 && len(c.Values) == 0
+}
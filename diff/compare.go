@@ -0,0 +1,105 @@
+package diff
+
+import (
+	"compareapp/k8s"
+	"context"
+	"log"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Listed are objects of the kind read from one side of the comparison
+type Listed struct {
+	Objects []unstructured.Unstructured
+	Status  Status
+}
+
+// PairResult is the comparison of the kind in one namespace pair
+type PairResult struct {
+	Side1    Side     `json:"side1"`
+	Side2    Side     `json:"side2"`
+	Objects1 []string `json:"objects1"`
+	Objects2 []string `json:"objects2"`
+	// Only1 are objects missing in the second cluster, Only2 in the first one
+	Only1 []string       `json:"only1"`
+	Only2 []string       `json:"only2"`
+	Diffs []ResourceDiff `json:"diffs"`
+	// Statuses are sides which could not be read, such pair is not compared
+	Statuses []Status `json:"errors,omitempty"`
+}
+
+// Result is the comparison of the kind in all namespace pairs
+type Result struct {
+	Kind  string       `json:"kind"`
+	Name  string       `json:"name"`
+	Pairs []PairResult `json:"pairs"`
+}
+
+// ListPairs reads objects of the kind on both sides of every pair concurrently,
+// returned error is the error of ctx (nobody waits for the result anymore). Pairs
+// must be kind.SidePairs of the selected pairs.
+func ListPairs(ctx context.Context, kind Kind, pairs [][2]Side) ([][2]Listed, error) {
+	listed := make([][2]Listed, len(pairs))
+	plan := k8s.NewPlan(ctx)
+	for i, pair := range pairs {
+		for j, side := range pair {
+			i, j, side := i, j, side
+			plan.Go(kind.Name+" in "+side.Cluster+"/"+side.Namespace, func(ctx context.Context) error {
+				objects, err := kind.List(ctx, side)
+				listed[i][j] = Listed{Objects: objects, Status: Status{Kind: kind.Name, Side: side, Index: j, Err: err}}
+				return err
+			})
+		}
+	}
+	for _, err := range plan.Wait() {
+		log.Println("Failed API call:", err)
+	}
+	return listed, ctx.Err()
+}
+
+// Compare reads the kind on both sides of every pair and compares objects with
+// the same names
+func Compare(ctx context.Context, kind Kind, pairs [][2]Side) (Result, error) {
+	pairs = kind.SidePairs(pairs)
+	listed, err := ListPairs(ctx, kind, pairs)
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := Result{Kind: kind.ID, Name: kind.Name, Pairs: make([]PairResult, 0, len(pairs))}
+	for i, pair := range pairs {
+		read1, read2 := listed[i][0], listed[i][1]
+		res := PairResult{
+			Side1:    pair[0],
+			Side2:    pair[1],
+			Objects1: Names(kind, read1.Objects),
+			Objects2: Names(kind, read2.Objects),
+			Only1:    []string{},
+			Only2:    []string{},
+			Diffs:    []ResourceDiff{},
+		}
+		// objects of the side which could not be read are not "missing", so the
+		// pair is not compared at all
+		for _, status := range []Status{read1.Status, read2.Status} {
+			if status.Failed() {
+				res.Statuses = append(res.Statuses, status)
+			}
+		}
+		if len(res.Statuses) == 0 {
+			res.Only1, res.Only2 = GetDiff(res.Objects1, res.Objects2)
+			res.Diffs = CompareObjects(kind, pair[0], read1.Objects, pair[1], read2.Objects)
+		}
+		result.Pairs = append(result.Pairs, res)
+	}
+	return result, nil
+}
+
+// Empty is true when there are no objects of the kind on both sides and nothing failed
+func (r Result) Empty() bool {
+	for _, pair := range r.Pairs {
+		if len(pair.Objects1) > 0 || len(pair.Objects2) > 0 || len(pair.Statuses) > 0 {
+			return false
+		}
+	}
+	return true
+}
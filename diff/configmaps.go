@@ -0,0 +1,191 @@
+package diff
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"path"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// ConfigMap values are usually whole config files. Files which can be parsed
+// (YAML, JSON, .properties, INI) are compared field by field, other values as
+// text (Change.TextDiff), binaryData only by size and sha256.
+
+// normalizeConfigMap parses values of data and replaces binaryData with fingerprints
+func normalizeConfigMap(spec interface{}) {
+	normalizeGeneric(spec)
+	obj, ok := spec.(map[string]interface{})
+	if !ok {
+		return
+	}
+	if data, ok := obj["data"].(map[string]interface{}); ok {
+		for key, value := range data {
+			if text, ok := value.(string); ok {
+				data[key] = parseEmbedded(key, text)
+			}
+		}
+	}
+	if binaryData, ok := obj["binaryData"].(map[string]interface{}); ok {
+		for key, value := range binaryData {
+			if encoded, ok := value.(string); ok {
+				binaryData[key] = fingerprint(encoded)
+			}
+		}
+	}
+}
+
+// fingerprint replaces base64 content with its size and sha256
+func fingerprint(encoded string) interface{} {
+	content, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		content = []byte(encoded)
+	}
+	sum := sha256.Sum256(content)
+	return map[string]interface{}{"size": int64(len(content)), "sha256": hex.EncodeToString(sum[:])}
+}
+
+// parseEmbedded returns parsed value of the config file: format is taken from
+// the key extension, values of other keys are parsed when they are JSON, or
+// multi-line INI, YAML or .properties documents (in this order). Text is returned as is.
+func parseEmbedded(key, value string) interface{} {
+	var parsed interface{}
+	var ok bool
+	switch strings.ToLower(path.Ext(key)) {
+	case ".json":
+		parsed, ok = parseJSONDocument(value)
+	case ".yaml", ".yml":
+		parsed, ok = parseYAMLDocument(value)
+	case ".properties":
+		parsed, ok = parseProperties(value, false)
+	case ".ini", ".cfg":
+		parsed, ok = parseINI(value, false)
+	default:
+		parsed, ok = parseJSONDocument(value)
+		// one line like "Note: text" or "a=b" is a plain value, not a config file
+		if ok || !strings.Contains(strings.TrimSpace(value), "\n") {
+			break
+		}
+		for _, parse := range []func(string) (interface{}, bool){
+			func(v string) (interface{}, bool) { return parseINI(v, true) },
+			parseYAMLDocument,
+			func(v string) (interface{}, bool) { return parseProperties(v, true) },
+		} {
+			if parsed, ok = parse(value); ok {
+				break
+			}
+		}
+	}
+	if !ok {
+		return value
+	}
+	return parsed
+}
+
+// parseJSONDocument parses JSON object or array, scalars are compared as text
+func parseJSONDocument(value string) (interface{}, bool) {
+	var parsed interface{}
+	if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+		return nil, false
+	}
+	return structured(parsed)
+}
+
+// parseYAMLDocument parses YAML mapping or list, almost any text is a valid YAML
+// string so scalars are compared as text
+func parseYAMLDocument(value string) (interface{}, bool) {
+	var parsed interface{}
+	if err := yaml.Unmarshal([]byte(value), &parsed); err != nil {
+		return nil, false
+	}
+	return structured(parsed)
+}
+
+func structured(parsed interface{}) (interface{}, bool) {
+	switch parsed.(type) {
+	case map[string]interface{}, []interface{}:
+		return parsed, true
+	}
+	return nil, false
+}
+
+// parseProperties parses java .properties: "key=value", "key: value" or
+// "key value", "\" at the end of line continues the value. Strict parsing
+// (format is guessed) accepts only lines with "=" or ":".
+func parseProperties(value string, strict bool) (interface{}, bool) {
+	properties := make(map[string]interface{})
+	var continued string
+	for _, line := range strings.Split(value, "\n") {
+		line = strings.TrimSpace(line)
+		if continued != "" {
+			line = continued + line
+			continued = ""
+		}
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") {
+			continue
+		}
+		if strings.HasSuffix(line, `\`) && !strings.HasSuffix(line, `\\`) {
+			continued = strings.TrimSuffix(line, `\`)
+			continue
+		}
+		sep := strings.IndexAny(line, "=:")
+		if sep < 0 {
+			if strict {
+				return nil, false
+			}
+			sep = strings.IndexAny(line, " \t")
+		}
+		if sep < 0 {
+			properties[line] = ""
+			continue
+		}
+		properties[strings.TrimSpace(line[:sep])] = strings.TrimSpace(line[sep+1:])
+	}
+	if continued != "" {
+		properties[continued] = ""
+	}
+	if len(properties) == 0 {
+		return nil, false
+	}
+	return properties, true
+}
+
+// parseINI parses "[section]" and "key = value" lines, keys before the first
+// section are top level. Strict parsing (format is guessed) needs a section.
+func parseINI(value string, strict bool) (interface{}, bool) {
+	ini := make(map[string]interface{})
+	current := ini
+	sections := 0
+	for _, line := range strings.Split(value, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			section, ok := ini[name].(map[string]interface{})
+			if !ok {
+				section = make(map[string]interface{})
+				ini[name] = section
+			}
+			current = section
+			sections++
+			continue
+		}
+		key, val, ok := strings.Cut(line, "=")
+		if !ok {
+			key, val, ok = strings.Cut(line, ":")
+		}
+		if !ok {
+			return nil, false
+		}
+		current[strings.TrimSpace(key)] = strings.TrimSpace(val)
+	}
+	if len(ini) == 0 || (strict && sections == 0) {
+		return nil, false
+	}
+	return ini, true
+}
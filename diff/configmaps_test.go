@@ -0,0 +1,133 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseEmbedded(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   string
+		value string
+		want  interface{}
+	}{
+		{
+			name:  "json by extension",
+			key:   "settings.json",
+			value: `{"debug": true, "workers": 4}`,
+			want:  map[string]interface{}{"debug": true, "workers": float64(4)},
+		},
+		{
+			name:  "yaml by extension",
+			key:   "app.yml",
+			value: "server:\n  port: 8080\n",
+			want:  map[string]interface{}{"server": map[string]interface{}{"port": float64(8080)}},
+		},
+		{
+			name:  "properties by extension",
+			key:   "application.properties",
+			value: "# comment\nserver.port=8080\nname: app\nlong = a \\\n  b\nflag\n",
+			want:  map[string]interface{}{"server.port": "8080", "name": "app", "long": "a b", "flag": ""},
+		},
+		{
+			name:  "ini by extension",
+			key:   "php.ini",
+			value: "engine = On\n[Date]\n; comment\ndate.timezone = UTC\n",
+			want:  map[string]interface{}{"engine": "On", "Date": map[string]interface{}{"date.timezone": "UTC"}},
+		},
+		{
+			name:  "json without extension",
+			key:   "config",
+			value: `[1, 2]`,
+			want:  []interface{}{float64(1), float64(2)},
+		},
+		{
+			name:  "json scalar is text",
+			key:   "replicas",
+			value: "3",
+			want:  "3",
+		},
+		{
+			name:  "one line is text",
+			key:   "LOG_LEVEL",
+			value: "level: debug",
+			want:  "level: debug",
+		},
+		{
+			name:  "ini guessed by section",
+			key:   "config",
+			value: "[server]\nport = 8080\n",
+			want:  map[string]interface{}{"server": map[string]interface{}{"port": "8080"}},
+		},
+		{
+			name:  "yaml guessed",
+			key:   "config",
+			value: "server:\n  port: 8080\n",
+			want:  map[string]interface{}{"server": map[string]interface{}{"port": float64(8080)}},
+		},
+		{
+			name:  "properties guessed",
+			key:   "config",
+			value: "a=1\nb=2\n",
+			want:  map[string]interface{}{"a": "1", "b": "2"},
+		},
+		{
+			name:  "multi-line text",
+			key:   "motd",
+			value: "Welcome!\nHave a nice day\n",
+			want:  "Welcome!\nHave a nice day\n",
+		},
+		{
+			name:  "broken json by extension is text",
+			key:   "settings.json",
+			value: `{"debug": `,
+			want:  `{"debug": `,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseEmbedded(tt.key, tt.value)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseEmbedded(%q) = %#v, want %#v", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseStrict(t *testing.T) {
+	tests := []struct {
+		name   string
+		parse  func(string, bool) (interface{}, bool)
+		value  string
+		strict bool
+		want   bool
+	}{
+		{"ini without section", parseINI, "a = 1\n", false, true},
+		{"strict ini without section", parseINI, "a = 1\n", true, false},
+		{"ini with text line", parseINI, "[a]\njust text\n", false, false},
+		{"empty ini", parseINI, "; comment\n", false, false},
+		{"properties with spaces", parseProperties, "key value\n", false, true},
+		{"strict properties with spaces", parseProperties, "key value\n", true, false},
+		{"empty properties", parseProperties, "# comment\n", false, false},
+	}
+	for _, tt := range tests {
+		if _, ok := tt.parse(tt.value, tt.strict); ok != tt.want {
+			t.Errorf("%s: ok = %v, want %v", tt.name, ok, tt.want)
+		}
+	}
+}
+
+func TestNormalizeConfigMapBinaryData(t *testing.T) {
+	obj := map[string]interface{}{
+		"binaryData": map[string]interface{}{"logo.png": "aGVsbG8="}, // "hello"
+	}
+	normalizeConfigMap(obj)
+	want := map[string]interface{}{
+		"size":   int64(5),
+		"sha256": "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+	}
+	if got := obj["binaryData"].(map[string]interface{})["logo.png"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("binaryData = %v, want %v", got, want)
+	}
+}
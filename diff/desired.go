@@ -0,0 +1,70 @@
+package diff
+
+import "compareapp/k8s"
+
+// Manifests from git have only the fields set by their authors, objects of the
+// cluster have every field defaulted by the API server (revisionHistoryLimit,
+// dnsPolicy, imagePullPolicy...). When one side is manifests, the other side is
+// compared only by the fields present in the desired object.
+
+// desiredSpecs returns specs of both sides with live-only fields removed when
+// exactly one of the sides is a directory of manifests
+func desiredSpecs(side1 Side, spec1 interface{}, side2 Side, spec2 interface{}) (interface{}, interface{}) {
+	desired1, desired2 := k8s.IsManifests(side1.Kubeconfig), k8s.IsManifests(side2.Kubeconfig)
+	switch {
+	case desired1 && !desired2:
+		spec2 = desiredFields(spec1, spec2, "")
+	case desired2 && !desired1:
+		spec1 = desiredFields(spec2, spec1, "")
+	}
+	return spec1, spec2
+}
+
+// desiredFields returns the live value without fields missing in the desired one.
+// Elements of keyed lists (containers, env...) are matched by merge key, live
+// elements missing in the desired list are kept, they are real drift.
+func desiredFields(desired, live interface{}, field string) interface{} {
+	switch d := desired.(type) {
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			return live
+		}
+		result := make(map[string]interface{}, len(d))
+		for k, item := range d {
+			if liveItem, ok := l[k]; ok {
+				result[k] = desiredFields(item, liveItem, k)
+			}
+		}
+		return result
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok {
+			return live
+		}
+		if key := mergeKey(field, d, l); key != "" {
+			items := make(map[string]interface{}, len(d))
+			for _, item := range d {
+				items[itemKey(item, key)] = item
+			}
+			result := make([]interface{}, len(l))
+			for i, liveItem := range l {
+				if item, ok := items[itemKey(liveItem, key)]; ok {
+					result[i] = desiredFields(item, liveItem, "")
+				} else {
+					result[i] = liveItem
+				}
+			}
+			return result
+		}
+		if len(d) != len(l) {
+			return live
+		}
+		result := make([]interface{}, len(l))
+		for i := range l {
+			result[i] = desiredFields(d[i], l[i], "")
+		}
+		return result
+	}
+	return live
+}
@@ -0,0 +1,87 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDesiredFields(t *testing.T) {
+	type obj = map[string]interface{}
+	type list = []interface{}
+	tests := []struct {
+		name          string
+		desired, live interface{}
+		want          interface{}
+	}{
+		{
+			name:    "defaulted fields removed",
+			desired: obj{"replicas": int64(2)},
+			live:    obj{"replicas": int64(3), "revisionHistoryLimit": int64(10), "progressDeadlineSeconds": int64(600)},
+			want:    obj{"replicas": int64(3)},
+		},
+		{
+			name:    "field missing in live stays missing",
+			desired: obj{"replicas": int64(2), "paused": true},
+			live:    obj{"replicas": int64(2)},
+			want:    obj{"replicas": int64(2)},
+		},
+		{
+			name: "containers matched by name, extra live container kept",
+			desired: obj{"containers": list{
+				obj{"name": "app", "image": "app:2"},
+			}},
+			live: obj{"containers": list{
+				obj{"name": "sidecar", "image": "proxy:1", "imagePullPolicy": "IfNotPresent"},
+				obj{"name": "app", "image": "app:1", "imagePullPolicy": "IfNotPresent"},
+			}},
+			want: obj{"containers": list{
+				obj{"name": "sidecar", "image": "proxy:1", "imagePullPolicy": "IfNotPresent"},
+				obj{"name": "app", "image": "app:1"},
+			}},
+		},
+		{
+			name:    "unkeyed lists of the same length pruned by position",
+			desired: obj{"tolerations": list{obj{"key": "spot"}}},
+			live:    obj{"tolerations": list{obj{"key": "spot", "operator": "Exists"}}},
+			want:    obj{"tolerations": list{obj{"key": "spot"}}},
+		},
+		{
+			name:    "unkeyed lists of different length kept",
+			desired: obj{"args": list{"--port=80"}},
+			live:    obj{"args": list{"--port=80", "--verbose"}},
+			want:    obj{"args": list{"--port=80", "--verbose"}},
+		},
+		{
+			name:    "different types kept",
+			desired: obj{"selector": obj{"app": "api"}},
+			live:    obj{"selector": "app=api"},
+			want:    obj{"selector": "app=api"},
+		},
+	}
+	for _, tt := range tests {
+		if got := desiredFields(tt.desired, tt.live, ""); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: desiredFields() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDesiredSpecs(t *testing.T) {
+	manifests := Side{Cluster: "manifests:prod", Kubeconfig: "manifests:/srv/prod"}
+	live := Side{Cluster: "prod", Kubeconfig: "/etc/kube/prod"}
+	desired := map[string]interface{}{"replicas": int64(2)}
+	liveSpec := map[string]interface{}{"replicas": int64(2), "revisionHistoryLimit": int64(10)}
+
+	spec1, spec2 := desiredSpecs(manifests, desired, live, liveSpec)
+	if !reflect.DeepEqual(spec2, desired) || !reflect.DeepEqual(spec1, desired) {
+		t.Errorf("manifests first: desiredSpecs() = %v, %v", spec1, spec2)
+	}
+	spec1, spec2 = desiredSpecs(live, liveSpec, manifests, desired)
+	if !reflect.DeepEqual(spec1, desired) {
+		t.Errorf("manifests second: desiredSpecs() = %v, %v", spec1, spec2)
+	}
+	// two live clusters are compared by all fields
+	spec1, _ = desiredSpecs(live, liveSpec, live, desired)
+	if !reflect.DeepEqual(spec1, liveSpec) {
+		t.Errorf("live clusters: desiredSpecs() = %v", spec1)
+	}
+}
@@ -0,0 +1,351 @@
+package diff
+
+import (
+	"compareapp/k8s"
+	"context"
+	"encoding/json"
+	"log"
+	"math"
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Normalizer removes or rewrites fields which must not be compared (they are
+// always different between clusters), it gets a copy of the compared field
+type Normalizer func(spec interface{})
+
+// Kind describes how objects of one resource type are fetched and compared,
+// adding new resource type to comparison is a Register call
+type Kind struct {
+	// ID is used in urls, Name is shown in the resource picker
+	ID   string
+	Name string
+	GVR  schema.GroupVersionResource
+	// Field is the compared part of the object, empty means the whole object
+	Field string
+	// NameOf returns key for matching objects between clusters, object name by default
+	NameOf func(obj unstructured.Unstructured) string
+	// Fetch overrides fetching objects by GVR (helm values are not kubernetes objects)
+	Fetch func(ctx context.Context, cluster, configPath, namespace string) ([]unstructured.Unstructured, error)
+	// Snapshot is the resource name in snapshots for kinds with Fetch, GVR is used by
+	// default; Fetch must read snapshots itself (see k8s.IsOffline)
+	Snapshot string
+	// Redact replaces values which must never be shown (Secret data) in every
+	// fetched object, before objects are compared, shown or saved to snapshots
+	Redact func(obj map[string]interface{})
+	// Filter keeps only fetched objects it returns true for (jobs created by cronjobs are skipped)
+	Filter    func(obj unstructured.Unstructured) bool
+	Normalize Normalizer
+	// Hostnames are fields with hostnames (paths in the ignore rule syntax), they
+	// are rewritten by hostname rewrites of the cluster (see SetHostnameRewrites)
+	Hostnames []string
+	// HostnameRules are applied instead when no compared cluster has hostname
+	// rewrites, hostnames which can't be rewritten are dropped
+	HostnameRules []IgnoreRule
+	// IgnoreRules are default ignore rules, they are replaced by rules from config
+	IgnoreRules []IgnoreRule
+	// RulesOf is the kind id whose ignore rules from config are used, the own id by default
+	RulesOf string
+	// Related kinds shown as buttons on the report page (canary -> metrictemplates)
+	Related []string
+	// Template of the report page, templates/compare_resources.html by default
+	Template string
+	// HideSpecs shows only the difference on the report page, without full specs
+	HideSpecs bool
+	// Sections are top level fields shown as separate sections of the report page
+	Sections []Section
+	// ClusterWide kinds are read from all namespaces at once (empty namespace of the
+	// sides) and compared once per cluster pair, objects are matched by NameOf only
+	ClusterWide bool
+}
+
+// Section is a top level field of compared objects with its title on the report page
+type Section struct {
+	Field string
+	Title string
+}
+
+// ResourceDiff is the difference of one object (matched by name) between two clusters
+type ResourceDiff struct {
+	Kind         string      `json:"kind"`
+	Name         string      `json:"name"`
+	SpecCluster1 interface{} `json:"spec1"`
+	SpecCluster2 interface{} `json:"spec2"`
+	Difference   string      `json:"-"` // nested diff as JSON for the report pages
+	Changes      []Change    `json:"changes"`
+	Cluster1     string      `json:"cluster1"`
+	Cluster2     string      `json:"cluster2"`
+	Namespace1   string      `json:"namespace1"`
+	Namespace2   string      `json:"namespace2"`
+}
+
+// ChangesUnder returns changes of the top level field, report pages show them as sections
+func (d ResourceDiff) ChangesUnder(field string) []Change {
+	var changes []Change
+	for _, change := range d.Changes {
+		if len(change.Path) > 0 && change.Path[0] == field {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+var registry = struct {
+	order []string
+	kinds map[string]Kind
+}{kinds: make(map[string]Kind)}
+
+// Register adds resource type to the diff engine
+func Register(kind Kind) {
+	if _, ok := registry.kinds[kind.ID]; ok {
+		panic("diff: kind " + kind.ID + " registered twice")
+	}
+	rules, err := compileRules(kind.IgnoreRules)
+	if err != nil {
+		panic("diff: kind " + kind.ID + ": " + err.Error())
+	}
+	kind.IgnoreRules = rules
+	if kind.HostnameRules, err = compileRules(kind.HostnameRules); err != nil {
+		panic("diff: kind " + kind.ID + ": " + err.Error())
+	}
+	registry.order = append(registry.order, kind.ID)
+	registry.kinds[kind.ID] = kind
+}
+
+// KindByID returns registered kind by its url id, ids of resources found by
+// discovery ("configmaps.v1") return the kind of the resource (see KindOf)
+func KindByID(id string) (Kind, bool) {
+	if kind, ok := registry.kinds[id]; ok {
+		return kind, true
+	}
+	if gvr, ok := parseGenericKindID(id); ok {
+		return KindOf(gvr), true
+	}
+	return Kind{}, false
+}
+
+// KindByName returns registered kind by the name shown in the resource picker
+func KindByName(name string) (Kind, bool) {
+	for _, id := range registry.order {
+		if registry.kinds[id].Name == name {
+			return registry.kinds[id], true
+		}
+	}
+	return Kind{}, false
+}
+
+// Kinds returns all registered kinds in registration order
+func Kinds() []Kind {
+	kinds := make([]Kind, 0, len(registry.order))
+	for _, id := range registry.order {
+		kinds = append(kinds, registry.kinds[id])
+	}
+	return kinds
+}
+
+// DefaultKinds are kinds compared when none are selected, cluster wide kinds
+// repeat their namespaced counterparts, so they are compared only on request
+func DefaultKinds() []Kind {
+	var kinds []Kind
+	for _, kind := range Kinds() {
+		if !kind.ClusterWide {
+			kinds = append(kinds, kind)
+		}
+	}
+	return kinds
+}
+
+// SidePairs returns sides the kind is compared on: namespace pairs as is, or one
+// pair of all namespaces per cluster pair for cluster wide kinds
+func (k Kind) SidePairs(pairs [][2]Side) [][2]Side {
+	if !k.ClusterWide {
+		return pairs
+	}
+	var wide [][2]Side
+	seen := make(map[[2]Side]bool)
+	for _, pair := range pairs {
+		pair[0].Namespace, pair[1].Namespace = "", ""
+		if !seen[pair] {
+			seen[pair] = true
+			wide = append(wide, pair)
+		}
+	}
+	return wide
+}
+
+// List fetches objects of the kind from namespace of the comparison side
+func (k Kind) List(ctx context.Context, side Side) ([]unstructured.Unstructured, error) {
+	var objects []unstructured.Unstructured
+	var err error
+	if k.Fetch != nil {
+		objects, err = k.Fetch(ctx, side.Cluster, side.Kubeconfig, side.Namespace)
+	} else {
+		objects, err = k8s.GetUniversalObjectsPerNsUnstruct(ctx, side.Cluster, side.Kubeconfig, side.Namespace, k.GVR.Group, k.GVR.Version, k.GVR.Resource)
+	}
+	if k.Filter != nil {
+		objects = filtered(objects, k.Filter)
+	}
+	if k.Redact != nil {
+		objects = redacted(objects, k.Redact)
+	}
+	return objects, err
+}
+
+func filtered(objects []unstructured.Unstructured, keep func(obj unstructured.Unstructured) bool) []unstructured.Unstructured {
+	var result []unstructured.Unstructured
+	for _, obj := range objects {
+		if keep(obj) {
+			result = append(result, obj)
+		}
+	}
+	return result
+}
+
+func (k Kind) nameOf(obj unstructured.Unstructured) string {
+	if k.NameOf != nil {
+		return k.NameOf(obj)
+	}
+	return obj.GetName()
+}
+
+// spec returns normalized copy of the compared field of the side's object,
+// fetched objects stay untouched. Rewritten is true when any compared cluster
+// has hostname rewrites (see hostnamesRewritten).
+func (k Kind) spec(obj unstructured.Unstructured, side Side, rewritten bool) (interface{}, bool) {
+	var spec interface{} = obj.Object
+	if k.Field != "" {
+		field, found, err := unstructured.NestedFieldNoCopy(obj.Object, k.Field)
+		if err != nil || !found {
+			return nil, false
+		}
+		spec = field
+	}
+	spec = deepCopy(spec)
+	if k.Normalize != nil {
+		k.Normalize(spec)
+	}
+	if rewritten {
+		spec = rewriteHostnames(spec, k.Hostnames, side.Cluster)
+	} else {
+		spec = applyRules(spec, k.HostnameRules)
+	}
+	return applyRules(spec, k.Rules()), true
+}
+
+// Names returns matching keys of the objects (object names for most kinds)
+func Names(kind Kind, objects []unstructured.Unstructured) []string {
+	names := make([]string, 0, len(objects))
+	for _, obj := range objects {
+		names = append(names, kind.nameOf(obj))
+	}
+	return names
+}
+
+// CompareObjects compares normalized specs of objects with the same name on two sides
+func CompareObjects(kind Kind, side1 Side, objects1 []unstructured.Unstructured, side2 Side, objects2 []unstructured.Unstructured) []ResourceDiff {
+	rewritten := hostnamesRewritten(side1, side2)
+	specs2 := make(map[string]interface{}, len(objects2))
+	for _, obj := range objects2 {
+		if spec, ok := kind.spec(obj, side2, rewritten); ok {
+			specs2[kind.nameOf(obj)] = spec
+		}
+	}
+
+	diffSpecs := []ResourceDiff{}
+	for _, obj := range objects1 {
+		spec1, ok := kind.spec(obj, side1, rewritten)
+		if !ok {
+			continue
+		}
+		name := kind.nameOf(obj)
+		spec2, ok := specs2[name]
+		if !ok {
+			continue
+		}
+		spec1, spec2 = desiredSpecs(side1, spec1, side2, spec2)
+		if reflect.DeepEqual(spec1, spec2) {
+			continue
+		}
+
+		changes := Changes(spec1, spec2)
+		diffBytes, err := json.Marshal(nestedDiff(changes))
+		if err != nil {
+			log.Printf("Failed to marshal difference map: %v", err)
+			continue
+		}
+		diffSpecs = append(diffSpecs, ResourceDiff{
+			Kind:         kind.Name,
+			Name:         name,
+			SpecCluster1: spec1,
+			SpecCluster2: spec2,
+			Difference:   string(diffBytes),
+			Changes:      changes,
+			Cluster1:     side1.Cluster,
+			Cluster2:     side2.Cluster,
+			Namespace1:   side1.Namespace,
+			Namespace2:   side2.Namespace,
+		})
+	}
+	return diffSpecs
+}
+
+// PairSpecs returns name -> cluster -> normalized spec for objects present on both
+// sides, it is used by the pages with full specs
+func PairSpecs(kind Kind, side1 Side, objects1 []unstructured.Unstructured, side2 Side, objects2 []unstructured.Unstructured) map[string]map[string]interface{} {
+	rewritten := hostnamesRewritten(side1, side2)
+	specs2 := make(map[string]interface{}, len(objects2))
+	for _, obj := range objects2 {
+		if spec, ok := kind.spec(obj, side2, rewritten); ok {
+			specs2[kind.nameOf(obj)] = spec
+		}
+	}
+
+	pairs := make(map[string]map[string]interface{})
+	for _, obj := range objects1 {
+		spec1, ok := kind.spec(obj, side1, rewritten)
+		if !ok {
+			continue
+		}
+		name := kind.nameOf(obj)
+		if spec2, ok := specs2[name]; ok {
+			spec1, spec2 := desiredSpecs(side1, spec1, side2, spec2)
+			pairs[name] = map[string]interface{}{
+				side1.Cluster: spec1,
+				side2.Cluster: spec2,
+			}
+		}
+	}
+	return pairs
+}
+
+// deepCopy copies the spec, whole numbers become int64: objects of the cluster
+// have int64, while helm values and snapshots decoded from JSON have float64
+func deepCopy(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			c[k] = deepCopy(item)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, item := range v {
+			c[i] = deepCopy(item)
+		}
+		return c
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return int64(v)
+		}
+		return v
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	default:
+		return v
+	}
+}
@@ -0,0 +1,124 @@
+package diff
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Kinds of resources found by API discovery are not registered, their ids are
+// "resource.version.group" ("ingresses.v1.networking.k8s.io", "configmaps.v1")
+// and KindByID builds them on the fly.
+
+// annotations written by kubectl and controllers, they differ between clusters for the same object
+var generatedAnnotations = []string{
+	"kubectl.kubernetes.io/last-applied-configuration",
+	"deployment.kubernetes.io/revision",
+}
+
+// GenericKindID returns id of the kind of any resource, like kubectl "resource.version.group"
+func GenericKindID(gvr schema.GroupVersionResource) string {
+	id := gvr.Resource + "." + gvr.Version
+	if gvr.Group != "" {
+		id += "." + gvr.Group
+	}
+	return id
+}
+
+// parseGenericKindID returns resource of the id built by GenericKindID
+func parseGenericKindID(id string) (schema.GroupVersionResource, bool) {
+	resource, rest, ok := strings.Cut(id, ".")
+	if !ok || resource == "" || rest == "" {
+		return schema.GroupVersionResource{}, false
+	}
+	version, group, _ := strings.Cut(rest, ".")
+	return schema.GroupVersionResource{Group: group, Version: version, Resource: resource}, true
+}
+
+// KindOf returns registered kind of the resource (deployments, services...) or
+// the generic kind for resources the diff engine knows nothing about. Registered
+// kinds of another version (v1beta1 gateways of older Gateway API) are read in the
+// given version, their id is the generic one so the version is kept in urls.
+func KindOf(gvr schema.GroupVersionResource) Kind {
+	if kind, ok := kindByResource(gvr.Group, gvr.Resource); ok {
+		if gvr.Version != "" && gvr.Version != kind.GVR.Version {
+			kind.RulesOf = kind.ID
+			kind.ID = GenericKindID(gvr)
+			kind.GVR.Version = gvr.Version
+		}
+		return kind
+	}
+	return GenericKind(gvr)
+}
+
+// RegistryID returns id of the registered kind the kind is made of (helmvalues
+// for helmvalues-all, gateways for v1beta1 gateways), its own id otherwise
+func (k Kind) RegistryID() string {
+	if k.RulesOf != "" {
+		return k.RulesOf
+	}
+	return k.ID
+}
+
+// Registered is true for kinds registered in the diff engine, kinds of resources
+// found by discovery are registered when the engine knows the resource
+func (k Kind) Registered() bool {
+	_, ok := registry.kinds[k.RegistryID()]
+	return ok
+}
+
+// kindByResource returns registered kind fetched from the cluster by group and
+// resource, version is not compared
+func kindByResource(group, resource string) (Kind, bool) {
+	for _, kind := range Kinds() {
+		if kind.Fetch == nil && kind.GVR.Group == group && kind.GVR.Resource == resource {
+			return kind, true
+		}
+	}
+	return Kind{}, false
+}
+
+// GenericKind compares whole objects of any namespaced resource: status and
+// metadata set by the cluster are dropped, labels and annotations are compared
+func GenericKind(gvr schema.GroupVersionResource) Kind {
+	name := gvr.Resource
+	if gvr.Group != "" {
+		name += "." + gvr.Group
+	}
+	return Kind{
+		ID:        GenericKindID(gvr),
+		Name:      name,
+		GVR:       gvr,
+		Normalize: normalizeGeneric,
+		Template:  "templates/compare_generic.html",
+		HideSpecs: true,
+	}
+}
+
+func normalizeGeneric(spec interface{}) {
+	obj, ok := spec.(map[string]interface{})
+	if !ok {
+		return
+	}
+	delete(obj, "status")
+	metadata, ok := obj["metadata"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	for key := range metadata {
+		if key != "labels" && key != "annotations" {
+			delete(metadata, key)
+		}
+	}
+	if annotations, ok := metadata["annotations"].(map[string]interface{}); ok {
+		for _, key := range generatedAnnotations {
+			delete(annotations, key)
+		}
+		if len(annotations) == 0 {
+			delete(metadata, "annotations")
+		}
+	}
+	if len(metadata) == 0 {
+		delete(obj, "metadata")
+	}
+}
@@ -0,0 +1,138 @@
+package diff
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Hostnames are different in every environment ("api.stage.example.com" and
+// "api.example.com"), rewrites from config bring hostnames of the cluster to
+// the common form before comparison, so the rest of the hostname is still compared.
+
+// HostnameRewrite rewrites hostnames matching From ("*.stage.example.com") to To
+// ("*.example.com"), every "*" of From matches one or more labels and is put
+// into "*" of To in the same order
+type HostnameRewrite struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+
+	re      *regexp.Regexp
+	replace string
+}
+
+// cluster name -> hostname rewrites applied to objects of the cluster
+var hostnameRewrites = map[string][]HostnameRewrite{}
+
+// hostname-like words of a string: hostnames and wildcards of ingresses, and
+// hostnames inside traefik rules like "Host(`api.example.com`) && PathPrefix(`/v1`)"
+var hostnameWord = regexp.MustCompile(`[A-Za-z0-9*_-]+(\.[A-Za-z0-9*_-]+)+`)
+
+// SetHostnameRewrites sets hostname rewrites of clusters from config
+func SetHostnameRewrites(rewrites map[string][]HostnameRewrite) error {
+	compiled := make(map[string][]HostnameRewrite, len(rewrites))
+	for cluster, list := range rewrites {
+		for _, rewrite := range list {
+			if err := rewrite.compile(); err != nil {
+				return fmt.Errorf("hostname rewrites of %s: %v", cluster, err)
+			}
+			compiled[cluster] = append(compiled[cluster], rewrite)
+		}
+	}
+	hostnameRewrites = compiled
+	return nil
+}
+
+func (r *HostnameRewrite) compile() error {
+	from := strings.Split(r.From, "*")
+	to := strings.Split(r.To, "*")
+	if r.From == "" || len(to) > len(from) {
+		return fmt.Errorf("%q -> %q: every * of the target must match * of the source", r.From, r.To)
+	}
+	for i := range from {
+		from[i] = regexp.QuoteMeta(from[i])
+	}
+	r.re = regexp.MustCompile("(?i)^" + strings.Join(from, `([a-z0-9*_-]+(?:\.[a-z0-9*_-]+)*)`) + "$")
+	for i := range to {
+		to[i] = strings.ReplaceAll(to[i], "$", "$$")
+	}
+	for i := 1; i < len(to); i++ {
+		to[i] = fmt.Sprintf("${%d}", i) + to[i]
+	}
+	r.replace = strings.Join(to, "")
+	return nil
+}
+
+// hostnamesRewritten is true when any of the compared clusters has hostname rewrites
+func hostnamesRewritten(sides ...Side) bool {
+	for _, side := range sides {
+		if len(hostnameRewrites[side.Cluster]) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// rewriteHostname returns the hostname rewritten by the first matching rewrite
+func rewriteHostname(hostname string, rewrites []HostnameRewrite) string {
+	for _, rewrite := range rewrites {
+		if rewrite.re.MatchString(hostname) {
+			return rewrite.re.ReplaceAllString(hostname, rewrite.replace)
+		}
+	}
+	return hostname
+}
+
+// rewriteHostnames rewrites hostnames in the fields of the spec (paths in the
+// ignore rule syntax) for objects of the cluster
+func rewriteHostnames(spec interface{}, paths []string, cluster string) interface{} {
+	rewrites := hostnameRewrites[cluster]
+	if len(rewrites) == 0 {
+		return spec
+	}
+	rewrite := func(value string) string {
+		return hostnameWord.ReplaceAllStringFunc(value, func(hostname string) string {
+			return rewriteHostname(hostname, rewrites)
+		})
+	}
+	for _, path := range paths {
+		segments, err := parseRulePath(path)
+		if err != nil || len(segments) == 0 {
+			continue
+		}
+		spec = rewriteStrings(spec, segments, rewrite)
+	}
+	return spec
+}
+
+// rewriteStrings returns node with string values at the path rewritten, maps are changed in place
+func rewriteStrings(node interface{}, segments []string, rewrite func(string) string) interface{} {
+	if len(segments) == 0 {
+		switch n := node.(type) {
+		case string:
+			return rewrite(n)
+		case []interface{}:
+			// "/tls/*/hosts" means every hostname of the list
+			for i := range n {
+				n[i] = rewriteStrings(n[i], nil, rewrite)
+			}
+		}
+		return node
+	}
+	segment, rest := segments[0], segments[1:]
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for k, child := range n {
+			if segment == "*" || segment == k {
+				n[k] = rewriteStrings(child, rest, rewrite)
+			}
+		}
+	case []interface{}:
+		for i, child := range n {
+			if segment == "*" || segment == fmt.Sprint(i) {
+				n[i] = rewriteStrings(child, rest, rewrite)
+			}
+		}
+	}
+	return node
+}
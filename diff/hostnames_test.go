@@ -0,0 +1,78 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRewriteHostname(t *testing.T) {
+	tests := []struct {
+		from, to string
+		hostname string
+		want     string
+	}{
+		{"*.stage.example.com", "*.example.com", "api.stage.example.com", "api.example.com"},
+		{"*.stage.example.com", "*.example.com", "a.b.stage.example.com", "a.b.example.com"},
+		{"*.stage.example.com", "*.example.com", "*.stage.example.com", "*.example.com"},
+		{"*.stage.example.com", "*.example.com", "API.Stage.Example.com", "API.example.com"},
+		{"*.stage.example.com", "*.example.com", "stage.example.com", "stage.example.com"},
+		{"*.stage.example.com", "*.example.com", "api.stage.example.com.evil.org", "api.stage.example.com.evil.org"},
+		{"*.stage.example.com", "*.example.com", "apixstagexexample.com", "apixstagexexample.com"},
+		{"stage.example.com", "example.com", "stage.example.com", "example.com"},
+		{"*-stage.*.example.com", "*.*.example.com", "api-stage.eu.example.com", "api.eu.example.com"},
+		{"*.stage.example.com", "static.example.com", "cdn.stage.example.com", "static.example.com"},
+		{"*.stage.example.com", "$1.example.com", "api.stage.example.com", "$1.example.com"},
+	}
+	for _, tt := range tests {
+		rewrite := HostnameRewrite{From: tt.from, To: tt.to}
+		if err := rewrite.compile(); err != nil {
+			t.Fatalf("compile(%q -> %q): %v", tt.from, tt.to, err)
+		}
+		if got := rewriteHostname(tt.hostname, []HostnameRewrite{rewrite}); got != tt.want {
+			t.Errorf("%q -> %q: rewriteHostname(%q) = %q, want %q", tt.from, tt.to, tt.hostname, got, tt.want)
+		}
+	}
+}
+
+func TestHostnameRewriteCompileErrors(t *testing.T) {
+	for _, rewrite := range []HostnameRewrite{
+		{From: "", To: "example.com"},
+		{From: "stage.example.com", To: "*.example.com"},
+	} {
+		if err := rewrite.compile(); err == nil {
+			t.Errorf("compile(%q -> %q) error = nil", rewrite.From, rewrite.To)
+		}
+	}
+}
+
+func TestRewriteHostnames(t *testing.T) {
+	if err := SetHostnameRewrites(map[string][]HostnameRewrite{
+		"stage": {{From: "*.stage.example.com", To: "*.example.com"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer SetHostnameRewrites(nil)
+
+	spec := func() map[string]interface{} {
+		return map[string]interface{}{
+			"rules": []interface{}{map[string]interface{}{"host": "api.stage.example.com", "path": "/v1.stage.example.com"}},
+			"tls":   []interface{}{map[string]interface{}{"hosts": []interface{}{"api.stage.example.com", "*.stage.example.com"}}},
+			"match": "Host(`a.stage.example.com`,`b.stage.example.com`) && PathPrefix(`/v1`)",
+		}
+	}
+	paths := []string{"/rules/*/host", "/tls/*/hosts", "/match"}
+	want := map[string]interface{}{
+		"rules": []interface{}{map[string]interface{}{"host": "api.example.com", "path": "/v1.stage.example.com"}},
+		"tls":   []interface{}{map[string]interface{}{"hosts": []interface{}{"api.example.com", "*.example.com"}}},
+		"match": "Host(`a.example.com`,`b.example.com`) && PathPrefix(`/v1`)",
+	}
+	if got := rewriteHostnames(spec(), paths, "stage"); !reflect.DeepEqual(got, want) {
+		t.Errorf("rewriteHostnames(stage) = %v, want %v", got, want)
+	}
+	if got := rewriteHostnames(spec(), paths, "prod"); !reflect.DeepEqual(got, spec()) {
+		t.Errorf("rewriteHostnames(prod) = %v, want unchanged", got)
+	}
+	if !hostnamesRewritten(Side{Cluster: "prod"}, Side{Cluster: "stage"}) || hostnamesRewritten(Side{Cluster: "prod"}) {
+		t.Error("hostnamesRewritten is wrong")
+	}
+}
@@ -0,0 +1,200 @@
+package diff
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// IgnoreRule drops (or rewrites) a field of compared specs before diffing.
+// Path is a JSON pointer ("/ports/*/nodePort") or JSONPath ("$.ports[*].nodePort"),
+// "*" matches any map key or list element. With Match the rule is applied only
+// when the value matches the regex, with Replace the matched part of a string
+// value is replaced instead of dropping the field.
+type IgnoreRule struct {
+	Path    string  `json:"path"`
+	Match   string  `json:"match,omitempty"`
+	Replace *string `json:"replace,omitempty"`
+
+	segments []string
+	re       *regexp.Regexp
+}
+
+// ignore rules from config by kind id, kinds missing here use their default rules
+var configuredRules = map[string][]IgnoreRule{}
+
+// SetIgnoreRules replaces default ignore rules of the kinds listed in config
+func SetIgnoreRules(rules map[string][]IgnoreRule) error {
+	configured := make(map[string][]IgnoreRule, len(rules))
+	for id, kindRules := range rules {
+		// kinds found by discovery have rules under their "resource.version.group" id,
+		// registered kinds (in any version) under the registered id
+		kind, ok := KindByID(id)
+		if !ok || kind.RegistryID() != id {
+			return fmt.Errorf("ignore rules: unknown kind %q", id)
+		}
+		compiled, err := compileRules(kindRules)
+		if err != nil {
+			return fmt.Errorf("ignore rules for %s: %v", id, err)
+		}
+		configured[id] = compiled
+	}
+	configuredRules = configured
+	return nil
+}
+
+// Rules returns ignore rules active for the kind
+func (k Kind) Rules() []IgnoreRule {
+	if rules, ok := configuredRules[k.RegistryID()]; ok {
+		return rules
+	}
+	return k.IgnoreRules
+}
+
+func (r IgnoreRule) String() string {
+	s := r.Path
+	if r.Match != "" {
+		s += " =~ " + r.Match
+	}
+	if r.Replace != nil {
+		s += " -> " + strconv.Quote(*r.Replace)
+	}
+	return s
+}
+
+func compileRules(rules []IgnoreRule) ([]IgnoreRule, error) {
+	compiled := make([]IgnoreRule, 0, len(rules))
+	for _, rule := range rules {
+		segments, err := parseRulePath(rule.Path)
+		if err != nil {
+			return nil, err
+		}
+		rule.segments = segments
+		if rule.Match != "" {
+			rule.re, err = regexp.Compile(rule.Match)
+			if err != nil {
+				return nil, fmt.Errorf("path %s: %v", rule.Path, err)
+			}
+		}
+		compiled = append(compiled, rule)
+	}
+	return compiled, nil
+}
+
+func parseRulePath(path string) ([]string, error) {
+	switch {
+	case strings.HasPrefix(path, "/"):
+		var segments []string
+		for _, segment := range strings.Split(path[1:], "/") {
+			segment = strings.ReplaceAll(segment, "~1", "/")
+			segments = append(segments, strings.ReplaceAll(segment, "~0", "~"))
+		}
+		return segments, nil
+	case strings.HasPrefix(path, "$"):
+		return parseJSONPath(path)
+	}
+	return nil, fmt.Errorf("path %q must be a JSON pointer (/a/b) or JSONPath ($.a.b)", path)
+}
+
+// parseJSONPath supports the subset used for ignore rules: $.a.b, $.a[*].b,
+// $.a[0], $.a['dotted.key'] and $.a.*
+func parseJSONPath(path string) ([]string, error) {
+	var segments []string
+	rest := path[1:]
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, "['"):
+			end := strings.Index(rest, "']")
+			if end < 0 {
+				return nil, fmt.Errorf("path %q: unclosed ['", path)
+			}
+			segments = append(segments, rest[2:end])
+			rest = rest[end+2:]
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("path %q: unclosed [", path)
+			}
+			segments = append(segments, rest[1:end])
+			rest = rest[end+1:]
+		case strings.HasPrefix(rest, "."):
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("path %q: empty field name", path)
+			}
+			segments = append(segments, rest[:end])
+			rest = rest[end:]
+		default:
+			return nil, fmt.Errorf("path %q: unexpected %q", path, rest)
+		}
+	}
+	return segments, nil
+}
+
+func applyRules(spec interface{}, rules []IgnoreRule) interface{} {
+	for i := range rules {
+		if len(rules[i].segments) > 0 {
+			spec = rules[i].apply(spec, rules[i].segments)
+		}
+	}
+	return spec
+}
+
+// apply returns node with the rule applied, maps are changed in place
+func (r *IgnoreRule) apply(node interface{}, segments []string) interface{} {
+	segment, rest := segments[0], segments[1:]
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for k, child := range n {
+			if segment != "*" && segment != k {
+				continue
+			}
+			if len(rest) > 0 {
+				n[k] = r.apply(child, rest)
+			} else if value, drop := r.act(child); drop {
+				delete(n, k)
+			} else {
+				n[k] = value
+			}
+		}
+		return n
+	case []interface{}:
+		kept := make([]interface{}, 0, len(n))
+		for i, child := range n {
+			if segment != "*" && segment != strconv.Itoa(i) {
+				kept = append(kept, child)
+				continue
+			}
+			if len(rest) > 0 {
+				kept = append(kept, r.apply(child, rest))
+			} else if value, drop := r.act(child); !drop {
+				kept = append(kept, value)
+			}
+		}
+		return kept
+	}
+	return node
+}
+
+// act returns new value of the matched field, drop is true when the field must be removed
+func (r *IgnoreRule) act(value interface{}) (interface{}, bool) {
+	if r.re == nil {
+		return nil, true
+	}
+	str, isString := value.(string)
+	if !isString {
+		str = fmt.Sprint(value)
+	}
+	if !r.re.MatchString(str) {
+		return value, false
+	}
+	if r.Replace != nil && isString {
+		return r.re.ReplaceAllString(str, *r.Replace), false
+	}
+	return nil, true
+}
@@ -0,0 +1,134 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRulePath(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    []string
+		wantErr bool
+	}{
+		{path: "/clusterIP", want: []string{"clusterIP"}},
+		{path: "/ports/*/nodePort", want: []string{"ports", "*", "nodePort"}},
+		{path: "/metadata/annotations/example.com~1key", want: []string{"metadata", "annotations", "example.com/key"}},
+		{path: "/a~0b", want: []string{"a~b"}},
+		{path: "$.ports[*].nodePort", want: []string{"ports", "*", "nodePort"}},
+		{path: "$.containers[0].image", want: []string{"containers", "0", "image"}},
+		{path: "$.metadata.annotations['example.com/key']", want: []string{"metadata", "annotations", "example.com/key"}},
+		{path: "$.labels.*", want: []string{"labels", "*"}},
+		{path: "clusterIP", wantErr: true},
+		{path: "$.ports[*", wantErr: true},
+		{path: "$.a['b", wantErr: true},
+		{path: "$..a", wantErr: true},
+		{path: "$a", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseRulePath(tt.path)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseRulePath(%q) error = %v, wantErr %v", tt.path, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseRulePath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func serviceSpec() map[string]interface{} {
+	return map[string]interface{}{
+		"clusterIP": "10.0.0.1",
+		"ports": []interface{}{
+			map[string]interface{}{"port": int64(80), "nodePort": int64(30080)},
+			map[string]interface{}{"port": int64(443), "nodePort": int64(30443)},
+		},
+		"image": "registry.example.com/team/app:1.2",
+	}
+}
+
+func TestApplyRules(t *testing.T) {
+	empty := ""
+	tests := []struct {
+		name  string
+		rules []IgnoreRule
+		want  map[string]interface{}
+	}{
+		{
+			name:  "pointer",
+			rules: []IgnoreRule{{Path: "/clusterIP"}},
+			want: map[string]interface{}{
+				"ports": serviceSpec()["ports"],
+				"image": "registry.example.com/team/app:1.2",
+			},
+		},
+		{
+			name:  "pointer with wildcard",
+			rules: []IgnoreRule{{Path: "/ports/*/nodePort"}},
+			want: map[string]interface{}{
+				"clusterIP": "10.0.0.1",
+				"ports":     []interface{}{map[string]interface{}{"port": int64(80)}, map[string]interface{}{"port": int64(443)}},
+				"image":     "registry.example.com/team/app:1.2",
+			},
+		},
+		{
+			name:  "jsonpath with index",
+			rules: []IgnoreRule{{Path: "$.ports[1].nodePort"}},
+			want: map[string]interface{}{
+				"clusterIP": "10.0.0.1",
+				"ports": []interface{}{
+					map[string]interface{}{"port": int64(80), "nodePort": int64(30080)},
+					map[string]interface{}{"port": int64(443)},
+				},
+				"image": "registry.example.com/team/app:1.2",
+			},
+		},
+		{
+			name:  "match drops only matching values",
+			rules: []IgnoreRule{{Path: "$.ports[*].port", Match: "^443$"}},
+			want: map[string]interface{}{
+				"clusterIP": "10.0.0.1",
+				"ports": []interface{}{
+					map[string]interface{}{"port": int64(80), "nodePort": int64(30080)},
+					map[string]interface{}{"nodePort": int64(30443)},
+				},
+				"image": "registry.example.com/team/app:1.2",
+			},
+		},
+		{
+			name:  "match with replace",
+			rules: []IgnoreRule{{Path: "/image", Match: "^.*/", Replace: &empty}},
+			want: map[string]interface{}{
+				"clusterIP": "10.0.0.1",
+				"ports":     serviceSpec()["ports"],
+				"image":     "app:1.2",
+			},
+		},
+		{
+			name:  "missing path",
+			rules: []IgnoreRule{{Path: "/status/loadBalancer"}},
+			want:  serviceSpec(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := compileRules(tt.rules)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := applyRules(serviceSpec(), rules)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("applyRules() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileRulesInvalid(t *testing.T) {
+	for _, rule := range []IgnoreRule{{Path: "ports"}, {Path: "/image", Match: "("}} {
+		if _, err := compileRules([]IgnoreRule{rule}); err == nil {
+			t.Errorf("compileRules(%v) error = nil", rule)
+		}
+	}
+}
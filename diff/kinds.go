@@ -0,0 +1,246 @@
+package diff
+
+import (
+	"compareapp/helm"
+	"compareapp/k8s"
+	"context"
+	"log"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// pod template annotations are changed by rollout restarts and admission webhooks
+var podTemplateRules = []IgnoreRule{{Path: "/template/metadata/annotations"}}
+
+func init() {
+	Register(Kind{
+		ID:          "deployments",
+		Name:        "Deployments",
+		GVR:         schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"},
+		Field:       "spec",
+		IgnoreRules: podTemplateRules,
+	})
+	Register(Kind{
+		ID:          "daemonsets",
+		Name:        "Daemonsets",
+		GVR:         schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "daemonsets"},
+		Field:       "spec",
+		IgnoreRules: podTemplateRules,
+	})
+	Register(Kind{
+		ID:    "statefulsets",
+		Name:  "StatefulSets",
+		GVR:   schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "statefulsets"},
+		Field: "spec",
+		IgnoreRules: append([]IgnoreRule{
+			// status, apiVersion and kind of the claim templates are set by the API server, depending on its version
+			{Path: "/volumeClaimTemplates/*/status"},
+			{Path: "/volumeClaimTemplates/*/apiVersion"},
+			{Path: "/volumeClaimTemplates/*/kind"},
+		}, podTemplateRules...),
+	})
+	Register(Kind{
+		ID:          "cronjobs",
+		Name:        "CronJobs",
+		GVR:         schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "cronjobs"},
+		Field:       "spec",
+		IgnoreRules: []IgnoreRule{{Path: "/jobTemplate/spec/template/metadata/annotations"}},
+	})
+	Register(Kind{
+		ID:     "jobs",
+		Name:   "Jobs",
+		GVR:    schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "jobs"},
+		Field:  "spec",
+		Filter: standaloneJob,
+		// selector and template labels have uid of the job
+		IgnoreRules: append([]IgnoreRule{
+			{Path: "/selector"},
+			{Path: "/template/metadata/labels/controller-uid"},
+			{Path: "/template/metadata/labels/batch.kubernetes.io~1controller-uid"},
+		}, podTemplateRules...),
+	})
+	Register(Kind{
+		ID:      "canaries",
+		Name:    "Flagger (Canary)",
+		GVR:     schema.GroupVersionResource{Group: "flagger.app", Version: "v1beta1", Resource: "canaries"},
+		Field:   "spec",
+		Related: []string{"metrictemplates"},
+	})
+	Register(Kind{
+		ID:    "metrictemplates",
+		Name:  "MetricTemplates",
+		GVR:   schema.GroupVersionResource{Group: "flagger.app", Version: "v1beta1", Resource: "metrictemplates"},
+		Field: "spec",
+	})
+	Register(Kind{
+		ID:    "ingressroutes",
+		Name:  "IngressRoutes (Traefik)",
+		GVR:   schema.GroupVersionResource{Group: "traefik.containo.us", Version: "v1alpha1", Resource: "ingressroutes"},
+		Field: "spec",
+		// hostnames are different in every cluster, see hostname_rewrites in config,
+		// without rewrites match rules are dropped
+		Hostnames:     []string{"/routes/*/match", "/tls/domains/*/main", "/tls/domains/*/sans"},
+		HostnameRules: []IgnoreRule{{Path: "/routes/*/match"}},
+		HideSpecs:     true,
+	})
+	// ingresses and gateway api are compared as whole objects, annotations
+	// configure ingress controllers (ingress-nginx) and the default class
+	Register(Kind{
+		ID:        "ingresses",
+		Name:      "Ingresses",
+		GVR:       schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"},
+		Normalize: normalizeGeneric,
+		// hostnames in annotations: server aliases, cors origins...
+		Hostnames: []string{"/spec/rules/*/host", "/spec/tls/*/hosts", "/metadata/annotations/*"},
+		Template:  "templates/compare_generic.html",
+		HideSpecs: true,
+	})
+	Register(Kind{
+		ID:          "ingressclasses",
+		Name:        "IngressClasses",
+		GVR:         schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "ingressclasses"},
+		Normalize:   normalizeGeneric,
+		Template:    "templates/compare_generic.html",
+		HideSpecs:   true,
+		ClusterWide: true, // cluster scoped resource
+	})
+	Register(Kind{
+		ID:        "gateways",
+		Name:      "Gateways (Gateway API)",
+		GVR:       schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "gateways"},
+		Normalize: normalizeGeneric,
+		Hostnames: []string{"/spec/listeners/*/hostname"},
+		Template:  "templates/compare_generic.html",
+		HideSpecs: true,
+	})
+	for _, route := range []struct{ resource, name, version string }{
+		{"httproutes", "HTTPRoutes", "v1"},
+		{"grpcroutes", "GRPCRoutes", "v1"},
+		{"tlsroutes", "TLSRoutes", "v1alpha2"},
+	} {
+		Register(Kind{
+			ID:        route.resource,
+			Name:      route.name + " (Gateway API)",
+			GVR:       schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: route.version, Resource: route.resource},
+			Normalize: normalizeGeneric,
+			Hostnames: []string{"/spec/hostnames"},
+			Template:  "templates/compare_generic.html",
+			HideSpecs: true,
+		})
+	}
+	Register(Kind{
+		ID:    "services",
+		Name:  "Services",
+		GVR:   schema.GroupVersionResource{Group: "", Version: "v1", Resource: "services"},
+		Field: "spec",
+		// ip addresses and node ports are allocated by cluster
+		IgnoreRules: []IgnoreRule{
+			{Path: "/clusterIP"},
+			{Path: "/clusterIPs"},
+			{Path: "/healthCheckNodePort"},
+			{Path: "/loadBalancerIP"},
+			{Path: "/ports/*/nodePort"},
+		},
+	})
+	Register(Kind{
+		ID:        "configmaps",
+		Name:      "ConfigMaps",
+		GVR:       schema.GroupVersionResource{Group: "", Version: "v1", Resource: "configmaps"},
+		Normalize: normalizeConfigMap,
+		Template:  "templates/compare_configmaps.html",
+		HideSpecs: true,
+		Sections: []Section{
+			{Field: "data", Title: "data (файлы конфигов сравниваются по полям, остальное построчно)"},
+			{Field: "binaryData", Title: "binaryData (размер и sha256)"},
+			{Field: "metadata", Title: "Labels и annotations"},
+			{Field: "immutable", Title: "immutable"},
+		},
+	})
+	Register(Kind{
+		ID:        "secrets",
+		Name:      "Secrets",
+		GVR:       schema.GroupVersionResource{Group: "", Version: "v1", Resource: "secrets"},
+		Redact:    redactSecret,
+		Normalize: normalizeSecret,
+		Template:  "templates/compare_secrets.html",
+		HideSpecs: true,
+	})
+	Register(Kind{
+		ID:       "helmvalues",
+		Name:     "HelmValues",
+		Fetch:    fetchHelmValues,
+		Snapshot: k8s.SnapshotHelmValues,
+		NameOf:   helmReleaseName,
+		// registries are different in every cluster, compare only image name and tag
+		IgnoreRules: []IgnoreRule{{Path: "/image", Match: "^.*/", Replace: new(string)}},
+		Template:    "templates/compare_values.html",
+		HideSpecs:   true,
+	})
+	Register(Kind{
+		ID:       "helmreleases",
+		Name:     "HelmReleases",
+		Fetch:    fetchHelmReleases,
+		Snapshot: k8s.SnapshotHelmReleases,
+		NameOf:   helmReleaseName,
+		Redact:   redactReleaseManifest,
+		// the same as for helmvalues, registries are different in every cluster
+		IgnoreRules: []IgnoreRule{{Path: "/values/image", Match: "^.*/", Replace: new(string)}},
+		Template:    "templates/compare_releases.html",
+		HideSpecs:   true,
+		Sections: []Section{
+			{Field: "chart", Title: "Чарт (name, version, appVersion)"},
+			{Field: "status", Title: "Статус релиза"},
+			{Field: "revisions", Title: "Количество ревизий"},
+			{Field: "lastDeployed", Title: "Время последнего деплоя"},
+			{Field: "values", Title: "Values (с дефолтами чарта)"},
+			{Field: "manifest", Title: "Отрендеренный манифест"},
+		},
+	})
+}
+
+// helm releases of all namespaces are matched by release name, namespaces of
+// the release can be different in every cluster
+func init() {
+	for _, id := range []string{"helmvalues", "helmreleases"} {
+		kind, _ := KindByID(id)
+		kind.RulesOf = kind.ID
+		kind.ID += "-all"
+		kind.Name += " (all namespaces)"
+		kind.Snapshot = "" // the same objects are captured by the namespaced kind
+		kind.ClusterWide = true
+		Register(kind)
+	}
+}
+
+func fetchHelmValues(ctx context.Context, cluster, configPath, namespace string) ([]unstructured.Unstructured, error) {
+	values, err := helm.GetHelmReleasesJsonPerNS(ctx, cluster, configPath, namespace)
+	if err != nil {
+		log.Println("Failed to get helm values for", cluster, err)
+	}
+	return values, err
+}
+
+func fetchHelmReleases(ctx context.Context, cluster, configPath, namespace string) ([]unstructured.Unstructured, error) {
+	releases, err := helm.GetHelmReleasesInfoPerNS(ctx, cluster, configPath, namespace)
+	if err != nil {
+		log.Println("Failed to get helm releases for", cluster, err)
+	}
+	return releases, err
+}
+
+// standaloneJob is false for jobs created by cronjobs, their names have the
+// schedule time and never match between clusters, cronjobs are compared instead
+func standaloneJob(obj unstructured.Unstructured) bool {
+	for _, owner := range obj.GetOwnerReferences() {
+		if owner.Kind == "CronJob" {
+			return false
+		}
+	}
+	return true
+}
+
+func helmReleaseName(obj unstructured.Unstructured) string {
+	name, _ := obj.Object["releaseName"].(string)
+	return name
+}
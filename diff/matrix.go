@@ -0,0 +1,348 @@
+package diff
+
+import (
+	"compareapp/k8s"
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MatrixResult is the comparison of the kind across N sides (dev, stage, prod...)
+type MatrixResult struct {
+	Kind   string        `json:"kind"`
+	Name   string        `json:"name"`
+	Groups []MatrixGroup `json:"groups"`
+}
+
+// MatrixGroup is one namespace in every cluster, Sides are columns of the matrix
+type MatrixGroup struct {
+	Sides []Side `json:"sides"`
+	// Statuses are sides which could not be read, such group is not compared
+	Statuses []Status `json:"errors,omitempty"`
+	// Missing are sides whose cluster has no such namespace, they are not compared
+	// (the namespace of extra clusters is the one of the second cluster)
+	Missing []bool         `json:"missing"`
+	Objects []MatrixObject `json:"objects"`
+}
+
+// MatrixObject is an object (matched by name) which is missing on some side or
+// differs somewhere, Present has an element per side
+type MatrixObject struct {
+	Name    string        `json:"name"`
+	Present []bool        `json:"present"`
+	Fields  []MatrixField `json:"fields"`
+}
+
+// MatrixField is a field which is not the same on all sides the object exists on.
+// Sides with the same class agree on the value, class is -1 where the field is missing.
+type MatrixField struct {
+	Path    []string      `json:"path"`
+	Values  []interface{} `json:"values"`
+	In      []bool        `json:"in"`
+	Classes []int         `json:"classes"`
+}
+
+// PathString returns path like "template.spec.containers[app].image"
+func (f MatrixField) PathString() string {
+	return joinPath(f.Path)
+}
+
+// Variant returns "A" for sides with the value of the first side with the field,
+// "B" for the next different value and so on, empty where the field is missing
+func (f MatrixField) Variant(i int) string {
+	class := f.Classes[i]
+	if class < 0 {
+		return ""
+	}
+	if class >= 26 {
+		return fmt.Sprint(class + 1)
+	}
+	return string(rune('A' + class))
+}
+
+// Empty is true when all sides of all groups have the same objects
+func (r MatrixResult) Empty() bool {
+	for _, group := range r.Groups {
+		if len(group.Objects) > 0 || len(group.Statuses) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// GroupSides returns sides the kind is compared on: namespace groups as is, or one
+// group of all namespaces per cluster list for cluster wide kinds (see SidePairs)
+func (k Kind) GroupSides(groups [][]Side) [][]Side {
+	if !k.ClusterWide {
+		return groups
+	}
+	var wide [][]Side
+	seen := make(map[string]bool)
+	for _, group := range groups {
+		sides := make([]Side, len(group))
+		clusters := make([]string, len(group))
+		for i, side := range group {
+			side.Namespace = ""
+			sides[i] = side
+			clusters[i] = side.Cluster
+		}
+		key := strings.Join(clusters, "\x00")
+		if !seen[key] {
+			seen[key] = true
+			wide = append(wide, sides)
+		}
+	}
+	return wide
+}
+
+// CompareMatrix reads the kind on every side of every group and compares objects
+// with the same names across all sides at once
+func CompareMatrix(ctx context.Context, kind Kind, groups [][]Side) (MatrixResult, error) {
+	groups = kind.GroupSides(groups)
+	listed := make([][]Listed, len(groups))
+	plan := k8s.NewPlan(ctx)
+	namespaces := clusterNamespaces(plan, groups)
+	for i, group := range groups {
+		listed[i] = make([]Listed, len(group))
+		for j, side := range group {
+			i, j, side := i, j, side
+			plan.Go(kind.Name+" in "+side.Cluster+"/"+side.Namespace, func(ctx context.Context) error {
+				objects, err := kind.List(ctx, side)
+				listed[i][j] = Listed{Objects: objects, Status: Status{Kind: kind.Name, Side: side, Index: j, Err: err}}
+				return err
+			})
+		}
+	}
+	for _, err := range plan.Wait() {
+		log.Println("Failed API call:", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return MatrixResult{}, err
+	}
+
+	result := MatrixResult{Kind: kind.ID, Name: kind.Name, Groups: make([]MatrixGroup, 0, len(groups))}
+	for i, group := range groups {
+		res := MatrixGroup{Sides: group, Missing: make([]bool, len(group)), Objects: []MatrixObject{}}
+		for j, read := range listed[i] {
+			if found, ok := namespaces[group[j].Cluster]; ok && !found[group[j].Namespace] {
+				res.Missing[j] = true
+				listed[i][j] = Listed{Status: Status{Kind: kind.Name, Side: group[j], Index: j}}
+				continue
+			}
+			if read.Status.Failed() {
+				res.Statuses = append(res.Statuses, read.Status)
+			}
+		}
+		if len(res.Statuses) == 0 {
+			res.Objects = compareMatrixObjects(kind, listed[i], res.Missing)
+		}
+		result.Groups = append(result.Groups, res)
+	}
+	return result, nil
+}
+
+// clusterNamespaces adds reading namespaces of live clusters to the plan, listing
+// a missing namespace is not an error so they are checked separately. Clusters
+// whose namespaces could not be read are not in the result (nothing is missing).
+func clusterNamespaces(plan *k8s.Plan, groups [][]Side) map[string]map[string]bool {
+	namespaces := make(map[string]map[string]bool)
+	var mu sync.Mutex
+	seen := make(map[string]bool)
+	for _, group := range groups {
+		for _, side := range group {
+			// manifests have objects without namespace for every namespace, snapshots report missing namespaces themselves
+			if side.Namespace == "" || k8s.IsOffline(side.Kubeconfig) || seen[side.Cluster] {
+				continue
+			}
+			seen[side.Cluster] = true
+			side := side
+			plan.Go("namespaces of "+side.Cluster, func(ctx context.Context) error {
+				list, err := k8s.FillNamespaces(ctx, side.Cluster, side.Kubeconfig)
+				if err != nil {
+					return err
+				}
+				found := make(map[string]bool, len(list))
+				for _, namespace := range list {
+					found[namespace] = true
+				}
+				mu.Lock()
+				namespaces[side.Cluster] = found
+				mu.Unlock()
+				return nil
+			})
+		}
+	}
+	return namespaces
+}
+
+func compareMatrixObjects(kind Kind, listed []Listed, missingNamespace []bool) []MatrixObject {
+	specs := make([]map[string]interface{}, len(listed))
+	sides := make([]Side, len(listed))
+	for i, read := range listed {
+		sides[i] = read.Status.Side
+	}
+	rewritten := hostnamesRewritten(sides...)
+	var names []string
+	seen := make(map[string]bool)
+	for i, read := range listed {
+		specs[i] = make(map[string]interface{})
+		for _, obj := range read.Objects {
+			name := kind.nameOf(obj)
+			spec, ok := kind.spec(obj, read.Status.Side, rewritten)
+			if !ok {
+				continue
+			}
+			specs[i][name] = spec
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	objects := []MatrixObject{}
+	for _, name := range names {
+		obj := MatrixObject{Name: name, Present: make([]bool, len(specs)), Fields: []MatrixField{}}
+		sideSpecs := make([]interface{}, len(specs))
+		missing := false
+		for i := range specs {
+			sideSpecs[i], obj.Present[i] = specs[i][name]
+			missing = missing || (!obj.Present[i] && !missingNamespace[i])
+		}
+		desiredMatrixSpecs(listed, sideSpecs, obj.Present)
+		obj.Fields = matrixFields(sideSpecs, obj.Present)
+		if missing || len(obj.Fields) > 0 {
+			objects = append(objects, obj)
+		}
+	}
+	return objects
+}
+
+// desiredMatrixSpecs removes live-only fields from specs of clusters when one of
+// the sides is a directory of manifests (see desiredSpecs)
+func desiredMatrixSpecs(listed []Listed, specs []interface{}, present []bool) {
+	desired := -1
+	for i, read := range listed {
+		if present[i] && k8s.IsManifests(read.Status.Side.Kubeconfig) {
+			desired = i
+			break
+		}
+	}
+	if desired < 0 {
+		return
+	}
+	for i, read := range listed {
+		if present[i] && !k8s.IsManifests(read.Status.Side.Kubeconfig) {
+			specs[i] = desiredFields(specs[desired], specs[i], "")
+		}
+	}
+}
+
+// matrixFields returns fields which differ between any two present specs: paths
+// are changes of every spec against the first present one, values are read back
+// from every spec by the path
+func matrixFields(specs []interface{}, present []bool) []MatrixField {
+	ref := -1
+	var paths [][]string
+	seen := make(map[string]bool)
+	for i, spec := range specs {
+		if !present[i] {
+			continue
+		}
+		if ref < 0 {
+			ref = i
+			continue
+		}
+		for _, change := range Changes(specs[ref], spec) {
+			key := strings.Join(change.Path, "\x00")
+			if !seen[key] {
+				seen[key] = true
+				paths = append(paths, change.Path)
+			}
+		}
+	}
+	sort.SliceStable(paths, func(i, j int) bool { return joinPath(paths[i]) < joinPath(paths[j]) })
+
+	fields := make([]MatrixField, 0, len(paths))
+	for _, path := range paths {
+		field := MatrixField{
+			Path:    path,
+			Values:  make([]interface{}, len(specs)),
+			In:      make([]bool, len(specs)),
+			Classes: make([]int, len(specs)),
+		}
+		var classes []interface{}
+		for i, spec := range specs {
+			field.Classes[i] = -1
+			if !present[i] {
+				continue
+			}
+			field.Values[i], field.In[i] = valueAt(spec, path)
+			if !field.In[i] {
+				continue
+			}
+			field.Classes[i] = len(classes)
+			for class, value := range classes {
+				if reflect.DeepEqual(value, field.Values[i]) {
+					field.Classes[i] = class
+					break
+				}
+			}
+			if field.Classes[i] == len(classes) {
+				classes = append(classes, field.Values[i])
+			}
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// valueAt returns value of the spec by the change path, "[key]" segments are
+// list elements matched by one of the merge keys of the list field
+func valueAt(spec interface{}, path []string) (interface{}, bool) {
+	value := spec
+	field := ""
+	for _, segment := range path {
+		if strings.HasPrefix(segment, "[") && strings.HasSuffix(segment, "]") {
+			list, ok := value.([]interface{})
+			if !ok {
+				return nil, false
+			}
+			value, ok = listItem(field, list, segment[1:len(segment)-1])
+			if !ok {
+				return nil, false
+			}
+			field = ""
+			continue
+		}
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		value, ok = m[segment]
+		if !ok {
+			return nil, false
+		}
+		field = segment
+	}
+	return value, true
+}
+
+func listItem(field string, list []interface{}, key string) (interface{}, bool) {
+	for _, mergeKey := range listMergeKeys[field] {
+		if !uniqueKey(list, mergeKey) {
+			continue
+		}
+		for _, item := range list {
+			if itemKey(item, mergeKey) == key {
+				return item, true
+			}
+		}
+	}
+	return nil, false
+}
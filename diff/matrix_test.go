@@ -0,0 +1,101 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValueAt(t *testing.T) {
+	spec := map[string]interface{}{
+		"replicas": int64(2),
+		"template": map[string]interface{}{
+			"containers": []interface{}{container("app", "app:1"), container("proxy", "proxy:1")},
+		},
+		"volumeClaimTemplates": []interface{}{claimTemplate("data", "10Gi")},
+		"args":                 []interface{}{"--verbose"},
+	}
+	tests := []struct {
+		path   []string
+		want   interface{}
+		wantIn bool
+	}{
+		{[]string{"replicas"}, int64(2), true},
+		{[]string{"template", "containers", "[proxy]", "image"}, "proxy:1", true},
+		{[]string{"template", "containers", "[app]"}, container("app", "app:1"), true},
+		{[]string{"volumeClaimTemplates", "[data]", "spec", "size"}, "10Gi", true},
+		{[]string{"template", "containers", "[sidecar]", "image"}, nil, false},
+		{[]string{"template", "containers", "[app]", "resources"}, nil, false},
+		{[]string{"args", "[--verbose]"}, nil, false}, // no merge key
+		{[]string{"replicas", "value"}, nil, false},
+		{[]string{"paused"}, nil, false},
+	}
+	for _, tt := range tests {
+		got, in := valueAt(spec, tt.path)
+		if in != tt.wantIn || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("valueAt(%q) = %v, %v, want %v, %v", tt.path, got, in, tt.want, tt.wantIn)
+		}
+	}
+}
+
+func TestMatrixFields(t *testing.T) {
+	spec := func(replicas int64, image string, extra map[string]interface{}) map[string]interface{} {
+		s := map[string]interface{}{
+			"replicas":   replicas,
+			"containers": []interface{}{container("app", image)},
+		}
+		for k, v := range extra {
+			s[k] = v
+		}
+		return s
+	}
+	tests := []struct {
+		name    string
+		specs   []interface{}
+		present []bool
+		want    []MatrixField
+	}{
+		{
+			name:    "equal",
+			specs:   []interface{}{spec(2, "app:1", nil), spec(2, "app:1", nil)},
+			present: []bool{true, true},
+			want:    []MatrixField{},
+		},
+		{
+			name:    "values grouped into classes, missing side skipped",
+			specs:   []interface{}{nil, spec(2, "app:1", nil), spec(3, "app:1", nil), spec(2, "app:2", nil)},
+			present: []bool{false, true, true, true},
+			want: []MatrixField{
+				{
+					Path:    []string{"containers", "[app]", "image"},
+					Values:  []interface{}{nil, "app:1", "app:1", "app:2"},
+					In:      []bool{false, true, true, true},
+					Classes: []int{-1, 0, 0, 1},
+				},
+				{
+					Path:    []string{"replicas"},
+					Values:  []interface{}{nil, int64(2), int64(3), int64(2)},
+					In:      []bool{false, true, true, true},
+					Classes: []int{-1, 0, 1, 0},
+				},
+			},
+		},
+		{
+			name:    "field only in one spec",
+			specs:   []interface{}{spec(2, "app:1", nil), spec(2, "app:1", nil), spec(2, "app:1", map[string]interface{}{"paused": true})},
+			present: []bool{true, true, true},
+			want: []MatrixField{
+				{
+					Path:    []string{"paused"},
+					Values:  []interface{}{nil, nil, true},
+					In:      []bool{false, false, true},
+					Classes: []int{-1, -1, 0},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		if got := matrixFields(tt.specs, tt.present); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: matrixFields() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package diff
+
+import (
+	"compareapp/helm"
+	"compareapp/k8s"
+	"context"
+	"log"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// releaseManifests are rendered manifests of helm releases, the kind is not
+// registered: manifests are shown in the HelmValues report under their release
+var releaseManifests = Kind{
+	ID:       "helmmanifests",
+	Name:     "Helm manifests",
+	Fetch:    fetchReleaseManifests,
+	Snapshot: k8s.SnapshotHelmReleases,
+	NameOf:   helmReleaseName,
+	Redact:   redactReleaseManifest,
+}
+
+// ReleaseManifests is the difference of objects rendered by the release with the
+// same name on both sides, values can be equal while chart versions render different objects
+type ReleaseManifests struct {
+	Release string `json:"release"`
+	Side1   Side   `json:"side1"`
+	Side2   Side   `json:"side2"`
+	// Only1 are objects ("Kind/name") rendered only on the first side, Only2 on the second one
+	Only1 []string       `json:"only1"`
+	Only2 []string       `json:"only2"`
+	Diffs []ResourceDiff `json:"diffs"`
+}
+
+func fetchReleaseManifests(ctx context.Context, cluster, configPath, namespace string) ([]unstructured.Unstructured, error) {
+	releases, err := helm.GetHelmReleaseManifestsPerNS(ctx, cluster, configPath, namespace)
+	if err != nil {
+		log.Println("Failed to get helm manifests for", cluster, err)
+	}
+	return releases, err
+}
+
+// CompareReleaseManifests compares manifests of releases with the same names in
+// every pair object by object, objects of registered kinds are compared the same
+// way as the kind (compared field and ignore rules), others as a whole. Only
+// releases with differences are returned; pairs with a side which could not be
+// read are returned as statuses.
+func CompareReleaseManifests(ctx context.Context, pairs [][2]Side) ([]ReleaseManifests, []Status, error) {
+	listed, err := ListPairs(ctx, releaseManifests, pairs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var results []ReleaseManifests
+	var statuses []Status
+	for i, pair := range pairs {
+		read1, read2 := listed[i][0], listed[i][1]
+		if read1.Status.Failed() || read2.Status.Failed() {
+			for _, status := range []Status{read1.Status, read2.Status} {
+				if status.Failed() {
+					statuses = append(statuses, status)
+				}
+			}
+			continue
+		}
+		manifests2 := make(map[string]map[string]interface{})
+		for _, rel := range read2.Objects {
+			manifests2[helmReleaseName(rel)] = releaseManifest(rel)
+		}
+		for _, rel := range read1.Objects {
+			name := helmReleaseName(rel)
+			manifest2, ok := manifests2[name]
+			if !ok {
+				continue
+			}
+			res := compareManifests(name, pair[0], releaseManifest(rel), pair[1], manifest2)
+			if len(res.Only1) > 0 || len(res.Only2) > 0 || len(res.Diffs) > 0 {
+				results = append(results, res)
+			}
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Release < results[j].Release })
+	return results, statuses, nil
+}
+
+func releaseManifest(rel unstructured.Unstructured) map[string]interface{} {
+	manifest, _ := rel.Object["manifest"].(map[string]interface{})
+	return manifest
+}
+
+func compareManifests(release string, side1 Side, manifest1 map[string]interface{}, side2 Side, manifest2 map[string]interface{}) ReleaseManifests {
+	names1 := sortedKeys(manifest1)
+	names2 := sortedKeys(manifest2)
+	res := ReleaseManifests{Release: release, Side1: side1, Side2: side2, Diffs: []ResourceDiff{}}
+	res.Only1, res.Only2 = GetDiff(names1, names2)
+	for _, name := range names1 {
+		object1, ok1 := manifest1[name].(map[string]interface{})
+		object2, ok2 := manifest2[name].(map[string]interface{})
+		if !ok1 || !ok2 {
+			continue
+		}
+		obj1 := unstructured.Unstructured{Object: object1}
+		obj2 := unstructured.Unstructured{Object: object2}
+		kind := kindOfObject(obj1)
+		for _, d := range CompareObjects(kind, side1, []unstructured.Unstructured{obj1}, side2, []unstructured.Unstructured{obj2}) {
+			d.Name = name
+			res.Diffs = append(res.Diffs, d)
+		}
+	}
+	return res
+}
+
+// kindOfObject returns registered kind of the object, objects of other kinds are compared as a whole
+func kindOfObject(obj unstructured.Unstructured) Kind {
+	gvk := obj.GroupVersionKind()
+	if kind, ok := kindByResource(gvk.Group, k8s.ResourceOfKind(gvk.Kind)); ok {
+		return kind
+	}
+	return releaseObjects
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,190 @@
+package diff
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Values of Secrets never leave the fetcher: data is replaced with fingerprints
+// right after the objects are read (Kind.Redact), so reports, JSON pages, the
+// API and snapshots have only "sha256:<hex>" (or "hmac-sha256:<key id>:<hex>")
+// of every value. Fingerprints of different schemes or keys can't be compared,
+// such values are reported as incomparable instead of different.
+
+// secretKey makes fingerprints HMAC-SHA256 with the server key when set, so
+// short values (passwords, ports) can't be found by hashing guesses
+var secretKey []byte
+
+// secretKeyID tells fingerprints of different keys apart without revealing the key
+var secretKeyID string
+
+// SetSecretKey sets the key of secret fingerprints, empty key means plain sha256
+func SetSecretKey(key string) {
+	secretKey = []byte(key)
+	secretKeyID = ""
+	if key != "" {
+		mac := hmac.New(sha256.New, secretKey)
+		mac.Write([]byte("key id"))
+		secretKeyID = hex.EncodeToString(mac.Sum(nil))[:8]
+	}
+}
+
+// SecretFingerprintScheme returns "sha256" or "hmac-sha256:<key id>" of the
+// current key, it is saved to snapshot manifests
+func SecretFingerprintScheme() string {
+	if len(secretKey) > 0 {
+		return strings.TrimSuffix(hmacPrefix, ":") + ":" + secretKeyID
+	}
+	return strings.TrimSuffix(sha256Prefix, ":")
+}
+
+const (
+	sha256Prefix = "sha256:"
+	hmacPrefix   = "hmac-sha256:"
+)
+
+// secretFingerprint returns fingerprint of the secret value
+func secretFingerprint(value []byte) string {
+	if len(secretKey) > 0 {
+		mac := hmac.New(sha256.New, secretKey)
+		mac.Write(value)
+		return hmacPrefix + secretKeyID + ":" + hex.EncodeToString(mac.Sum(nil))
+	}
+	sum := sha256.Sum256(value)
+	return sha256Prefix + hex.EncodeToString(sum[:])
+}
+
+// isFingerprint is true for values redacted already (snapshots keep fingerprints),
+// ":" is not in base64 alphabet so real values never match
+func isFingerprint(value string) bool {
+	return strings.HasPrefix(value, sha256Prefix) || strings.HasPrefix(value, hmacPrefix)
+}
+
+// fingerprintScheme returns scheme of the fingerprint: "sha256", "hmac-sha256:<key id>"
+// or "hmac-sha256" of fingerprints made before key ids were added
+func fingerprintScheme(fingerprint string) string {
+	if i := strings.LastIndex(fingerprint, ":"); i >= 0 {
+		return fingerprint[:i]
+	}
+	return ""
+}
+
+// fingerprintsIncomparable is true for fingerprints made by different schemes or
+// keys (snapshot captured with another secret_fingerprint_key), equal values have
+// different fingerprints then
+func fingerprintsIncomparable(v1, v2 interface{}) bool {
+	f1, ok1 := v1.(string)
+	f2, ok2 := v2.(string)
+	return ok1 && ok2 && isFingerprint(f1) && isFingerprint(f2) && fingerprintScheme(f1) != fingerprintScheme(f2)
+}
+
+// FingerprintsComparable is false when both values are fingerprints of different schemes or keys
+func FingerprintsComparable(v1, v2 interface{}) bool {
+	return !fingerprintsIncomparable(v1, v2)
+}
+
+// redactSecret replaces values of data and stringData (manifests from git) of the
+// Secret with fingerprints of the decoded values, kubectl last applied
+// configuration is dropped as it has the values too
+func redactSecret(obj map[string]interface{}) {
+	data, ok := obj["data"].(map[string]interface{})
+	if !ok {
+		data = make(map[string]interface{})
+	}
+	for key, value := range data {
+		encoded, _ := value.(string)
+		if isFingerprint(encoded) {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			decoded = []byte(encoded)
+		}
+		data[key] = secretFingerprint(decoded)
+	}
+	// stringData is merged into data by the API server, stringData wins
+	if stringData, ok := obj["stringData"].(map[string]interface{}); ok {
+		for key, value := range stringData {
+			text, _ := value.(string)
+			data[key] = secretFingerprint([]byte(text))
+		}
+		delete(obj, "stringData")
+	}
+	obj["data"] = data
+
+	if annotations, ok := nestedMap(obj, "metadata", "annotations"); ok {
+		delete(annotations, "kubectl.kubernetes.io/last-applied-configuration")
+	}
+}
+
+// redactObjectSecret redacts the object when it is a Secret (helm manifests have objects of any kind)
+func redactObjectSecret(obj map[string]interface{}) {
+	if kind, _ := obj["kind"].(string); kind == "Secret" {
+		if apiVersion, _ := obj["apiVersion"].(string); apiVersion == "v1" {
+			redactSecret(obj)
+		}
+	}
+}
+
+// redactReleaseManifest redacts Secrets rendered by the helm release
+func redactReleaseManifest(obj map[string]interface{}) {
+	manifest, ok := obj["manifest"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	for _, item := range manifest {
+		if object, ok := item.(map[string]interface{}); ok {
+			redactObjectSecret(object)
+		}
+	}
+}
+
+// normalizeSecret compares type, keys and fingerprints of the values, labels and annotations
+func normalizeSecret(spec interface{}) {
+	obj, ok := spec.(map[string]interface{})
+	if !ok {
+		return
+	}
+	// objects of helm manifests are not redacted by the fetcher
+	redactSecret(obj)
+	normalizeGeneric(obj)
+	if _, ok := obj["type"].(string); !ok {
+		obj["type"] = "Opaque" // default of the API server, manifests can omit it
+	}
+}
+
+// normalizeReleaseObject redacts Secrets of rendered releases (chart and revision diffs)
+func normalizeReleaseObject(spec interface{}) {
+	if obj, ok := spec.(map[string]interface{}); ok {
+		redactObjectSecret(obj)
+	}
+}
+
+// redacted returns copies of the objects with secret values replaced, fetched
+// objects can be shared (manifests are cached) so they are not changed
+func redacted(objects []unstructured.Unstructured, redact func(obj map[string]interface{})) []unstructured.Unstructured {
+	result := make([]unstructured.Unstructured, len(objects))
+	for i := range objects {
+		obj := deepCopy(objects[i].Object).(map[string]interface{})
+		redact(obj)
+		result[i] = unstructured.Unstructured{Object: obj}
+	}
+	return result
+}
+
+func nestedMap(obj map[string]interface{}, fields ...string) (map[string]interface{}, bool) {
+	m := obj
+	for _, field := range fields {
+		child, ok := m[field].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		m = child
+	}
+	return m, true
+}
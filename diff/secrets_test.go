@@ -0,0 +1,127 @@
+package diff
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func secretObject() map[string]interface{} {
+	return map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata": map[string]interface{}{
+			"name": "db",
+			"annotations": map[string]interface{}{
+				"kubectl.kubernetes.io/last-applied-configuration": `{"data":{"password":"czNjcjN0LXBhc3N3b3Jk"}}`,
+			},
+		},
+		"data": map[string]interface{}{
+			"password": base64.StdEncoding.EncodeToString([]byte("s3cr3t-password")),
+		},
+		"stringData": map[string]interface{}{
+			"user": "admin-user",
+		},
+	}
+}
+
+func TestRedactSecret(t *testing.T) {
+	defer SetSecretKey("")
+	for _, key := range []string{"", "server-key"} {
+		SetSecretKey(key)
+		obj := secretObject()
+		redactSecret(obj)
+
+		data, err := json.Marshal(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, plain := range []string{"s3cr3t-password", "czNjcjN0LXBhc3N3b3Jk", "admin-user", "YWRtaW4tdXNlcg"} {
+			if strings.Contains(string(data), plain) {
+				t.Errorf("key %q: redacted secret has %q: %s", key, plain, data)
+			}
+		}
+		if _, ok := obj["stringData"]; ok {
+			t.Errorf("key %q: stringData is not removed", key)
+		}
+		values := obj["data"].(map[string]interface{})
+		prefix := "sha256:"
+		if key != "" {
+			prefix = "hmac-sha256:" + secretKeyID + ":"
+		}
+		for _, k := range []string{"password", "user"} {
+			if value, _ := values[k].(string); !strings.HasPrefix(value, prefix) {
+				t.Errorf("key %q: data[%s] = %q, want %s fingerprint", key, k, value, prefix)
+			}
+		}
+
+		// snapshots have fingerprints already, they are kept as is
+		again := deepCopy(obj).(map[string]interface{})
+		redactSecret(again)
+		if !equalJSON(t, again, obj) {
+			t.Errorf("key %q: redaction is not idempotent", key)
+		}
+	}
+}
+
+func TestSecretFingerprint(t *testing.T) {
+	defer SetSecretKey("")
+	SetSecretKey("")
+	plain := secretFingerprint([]byte("hello"))
+	if plain != "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Errorf("sha256 fingerprint = %s", plain)
+	}
+	SetSecretKey("key1")
+	key1 := secretFingerprint([]byte("hello"))
+	SetSecretKey("key2")
+	key2 := secretFingerprint([]byte("hello"))
+	if key1 == key2 || key1 == plain {
+		t.Errorf("fingerprints of different keys are equal: %s, %s", key1, key2)
+	}
+
+	tests := []struct {
+		v1, v2       interface{}
+		incomparable bool
+	}{
+		{plain, plain, false},
+		{key1, key1, false},
+		{plain, key1, true},
+		{key1, key2, true},
+		{"hmac-sha256:0123", key1, true}, // made before key ids
+		{"text", key1, false},
+		{int64(1), key1, false},
+	}
+	for _, tt := range tests {
+		if got := fingerprintsIncomparable(tt.v1, tt.v2); got != tt.incomparable {
+			t.Errorf("fingerprintsIncomparable(%v, %v) = %v, want %v", tt.v1, tt.v2, got, tt.incomparable)
+		}
+	}
+}
+
+func TestRedactReleaseManifest(t *testing.T) {
+	release := map[string]interface{}{
+		"manifest": map[string]interface{}{
+			"Secret/db":      secretObject(),
+			"ConfigMap/conf": map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap", "data": map[string]interface{}{"a": "b"}},
+		},
+	}
+	redactReleaseManifest(release)
+	data, _ := json.Marshal(release)
+	if strings.Contains(string(data), "admin-user") || !strings.Contains(string(data), `"a":"b"`) {
+		t.Errorf("redacted release manifest = %s", data)
+	}
+}
+
+func equalJSON(t *testing.T, a, b interface{}) bool {
+	t.Helper()
+	ja, err := json.Marshal(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jb, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(ja) == string(jb)
+}
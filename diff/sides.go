@@ -0,0 +1,78 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Side is one side of the comparison, every fetch is done with its own
+// cluster, kubeconfig and namespace
+type Side struct {
+	Cluster    string `json:"cluster"`
+	Kubeconfig string `json:"-"`
+	Namespace  string `json:"namespace"`
+}
+
+// NamespacePair is namespace in the first cluster and its counterpart in the second one
+type NamespacePair struct {
+	Namespace1 string `json:"namespace1"`
+	Namespace2 string `json:"namespace2"`
+}
+
+// Sides returns both comparison sides for the namespace pair
+func (p NamespacePair) Sides(cluster1, kubeconfig1, cluster2, kubeconfig2 string) (Side, Side) {
+	return Side{Cluster: cluster1, Kubeconfig: kubeconfig1, Namespace: p.Namespace1},
+		Side{Cluster: cluster2, Kubeconfig: kubeconfig2, Namespace: p.Namespace2}
+}
+
+// default namespace mapping from config, e.g. "payments-stage" -> "payments"
+var namespaceMapping = map[string]string{}
+
+// SetNamespaceMapping sets default namespace mapping used by PairNamespaces
+func SetNamespaceMapping(mapping map[string]string) {
+	if mapping == nil {
+		mapping = map[string]string{}
+	}
+	namespaceMapping = mapping
+}
+
+// ParseNamespaceMapping parses "foo-stage=foo" lines entered on the namespaces page
+func ParseNamespaceMapping(text string) (map[string]string, error) {
+	mapping := make(map[string]string)
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ns1, ns2, ok := strings.Cut(line, "=")
+		ns1, ns2 = strings.TrimSpace(ns1), strings.TrimSpace(ns2)
+		if !ok || ns1 == "" || ns2 == "" {
+			return nil, fmt.Errorf("wrong namespace mapping %q, expected namespace1=namespace2", line)
+		}
+		mapping[ns1] = ns2
+	}
+	return mapping, nil
+}
+
+// PairNamespaces pairs namespaces selected in the first cluster with namespaces of
+// the second one. One namespace selected on each side are compared with each other,
+// otherwise counterpart is taken from the mapping (form mapping first, then config)
+// or namespace with the same name is used.
+func PairNamespaces(namespaces1, namespaces2 []string, mapping map[string]string) []NamespacePair {
+	if len(namespaces1) == 1 && len(namespaces2) == 1 {
+		return []NamespacePair{{Namespace1: namespaces1[0], Namespace2: namespaces2[0]}}
+	}
+
+	pairs := make([]NamespacePair, 0, len(namespaces1))
+	for _, ns1 := range namespaces1 {
+		ns2, ok := mapping[ns1]
+		if !ok {
+			ns2, ok = namespaceMapping[ns1]
+		}
+		if !ok {
+			ns2 = ns1
+		}
+		pairs = append(pairs, NamespacePair{Namespace1: ns1, Namespace2: ns2})
+	}
+	return pairs
+}
@@ -0,0 +1,82 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseNamespaceMapping(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    map[string]string
+		wantErr bool
+	}{
+		{text: "", want: map[string]string{}},
+		{text: "foo-stage=foo", want: map[string]string{"foo-stage": "foo"}},
+		{text: " foo-stage = foo \n\n# comment\nbar-stage=bar\r\n", want: map[string]string{"foo-stage": "foo", "bar-stage": "bar"}},
+		{text: "foo-stage", wantErr: true},
+		{text: "=foo", wantErr: true},
+		{text: "foo-stage=", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseNamespaceMapping(tt.text)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseNamespaceMapping(%q) error = %v, wantErr %v", tt.text, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseNamespaceMapping(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestPairNamespaces(t *testing.T) {
+	SetNamespaceMapping(map[string]string{"payments-stage": "payments", "orders-stage": "orders"})
+	defer SetNamespaceMapping(nil)
+
+	tests := []struct {
+		name                     string
+		namespaces1, namespaces2 []string
+		mapping                  map[string]string
+		want                     []NamespacePair
+	}{
+		{
+			name:        "one namespace on each side",
+			namespaces1: []string{"payments-stage"},
+			namespaces2: []string{"billing"},
+			want:        []NamespacePair{{"payments-stage", "billing"}},
+		},
+		{
+			name:        "config mapping",
+			namespaces1: []string{"payments-stage", "orders-stage"},
+			want:        []NamespacePair{{"payments-stage", "payments"}, {"orders-stage", "orders"}},
+		},
+		{
+			name:        "form mapping first",
+			namespaces1: []string{"payments-stage", "orders-stage"},
+			mapping:     map[string]string{"orders-stage": "orders-v2"},
+			want:        []NamespacePair{{"payments-stage", "payments"}, {"orders-stage", "orders-v2"}},
+		},
+		{
+			name:        "same names without mapping",
+			namespaces1: []string{"monitoring", "payments-stage"},
+			namespaces2: []string{"monitoring", "payments"},
+			want:        []NamespacePair{{"monitoring", "monitoring"}, {"payments-stage", "payments"}},
+		},
+		{
+			name:        "one namespace without counterpart",
+			namespaces1: []string{"monitoring"},
+			want:        []NamespacePair{{"monitoring", "monitoring"}},
+		},
+		{
+			name: "nothing selected",
+			want: []NamespacePair{},
+		},
+	}
+	for _, tt := range tests {
+		got := PairNamespaces(tt.namespaces1, tt.namespaces2, tt.mapping)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: PairNamespaces() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
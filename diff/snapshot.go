@@ -0,0 +1,75 @@
+package diff
+
+import (
+	"compareapp/k8s"
+	"context"
+	"log"
+	"sync"
+)
+
+// snapshotResource returns resource name of the kind in snapshots, empty when the
+// kind can not be captured
+func (k Kind) snapshotResource() string {
+	if k.Snapshot != "" {
+		return k.Snapshot
+	}
+	// snapshots are captured per namespace, cluster scoped resources are not in them
+	if k.Fetch != nil || k.GVR.Resource == "" || k.ClusterWide {
+		return ""
+	}
+	return k8s.SnapshotResource(k.GVR.Group, k.GVR.Version, k.GVR.Resource)
+}
+
+// Capture reads the kinds in namespaces of the cluster (all namespaces when none
+// given) and writes them into snapshot directory or .tar.gz. Objects which could
+// not be read are returned as failed statuses and are not in the snapshot, CRDs
+// missing in the cluster are marked as not installed.
+func Capture(ctx context.Context, cluster, kubeconfig string, namespaces []string, kinds []Kind, path string) (k8s.SnapshotManifest, []Status, error) {
+	manifest := k8s.SnapshotManifest{Cluster: cluster, Namespaces: namespaces, SecretFingerprints: SecretFingerprintScheme()}
+	version, err := k8s.ClusterVersion(ctx, cluster, kubeconfig, false)
+	if err != nil {
+		return manifest, nil, err
+	}
+	manifest.KubernetesVersion, _ = version.(string)
+	if len(manifest.Namespaces) == 0 {
+		if manifest.Namespaces, err = k8s.FillNamespaces(ctx, cluster, kubeconfig); err != nil {
+			return manifest, nil, err
+		}
+	}
+
+	writer := k8s.NewSnapshotWriter(path, manifest)
+	var mu sync.Mutex
+	var statuses []Status
+	plan := k8s.NewPlan(ctx)
+	for _, kind := range kinds {
+		resource := kind.snapshotResource()
+		if resource == "" {
+			continue
+		}
+		for _, namespace := range manifest.Namespaces {
+			kind, resource, side := kind, resource, Side{Cluster: cluster, Kubeconfig: kubeconfig, Namespace: namespace}
+			plan.Go(kind.Name+" in "+cluster+"/"+namespace, func(ctx context.Context) error {
+				objects, err := kind.List(ctx, side)
+				if k8s.IsNotInstalled(err) {
+					writer.NotInstalled(resource)
+					return nil
+				}
+				if err != nil {
+					mu.Lock()
+					statuses = append(statuses, Status{Kind: kind.Name, Side: side, Err: err})
+					mu.Unlock()
+					return err
+				}
+				return writer.Add(side.Namespace, resource, objects)
+			})
+		}
+	}
+	for _, err := range plan.Wait() {
+		log.Println("Failed API call:", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return manifest, statuses, err
+	}
+	manifest, err = writer.Close()
+	return manifest, statuses, err
+}
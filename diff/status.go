@@ -0,0 +1,53 @@
+package diff
+
+import (
+	"compareapp/k8s"
+	"encoding/json"
+	"fmt"
+)
+
+// Status is the result of reading the kind on one side of the comparison,
+// failed sides are shown in the report instead of a false diff
+type Status struct {
+	Kind string
+	Side Side
+	// Index is the position of the side in the pair or matrix group (0 is the
+	// first cluster), sides can be equal when a namespace is compared with itself
+	Index int
+	Err   error
+}
+
+// Failed is true when objects of the side could not be read
+func (s Status) Failed() bool {
+	return s.Err != nil
+}
+
+// Reason returns why objects could not be read (forbidden, timeout etc.)
+func (s Status) Reason() k8s.Reason {
+	return k8s.ReasonOf(s.Err)
+}
+
+func (s Status) MarshalJSON() ([]byte, error) {
+	status := struct {
+		Kind      string     `json:"kind"`
+		Cluster   string     `json:"cluster"`
+		Namespace string     `json:"namespace"`
+		Index     int        `json:"index"`
+		Reason    k8s.Reason `json:"reason,omitempty"`
+		Message   string     `json:"message,omitempty"`
+	}{Kind: s.Kind, Cluster: s.Side.Cluster, Namespace: s.Side.Namespace, Index: s.Index}
+	if s.Failed() {
+		status.Reason = s.Reason()
+		status.Message = s.Message()
+	}
+	return json.Marshal(status)
+}
+
+// Message is "could not read Canaries in cluster B/namespace: forbidden"
+func (s Status) Message() string {
+	where := s.Side.Cluster
+	if s.Side.Namespace != "" {
+		where += "/" + s.Side.Namespace
+	}
+	return fmt.Sprintf("could not read %s in cluster %s: %s", s.Kind, where, s.Reason())
+}
@@ -5,6 +5,8 @@ go 1.20
 require (
 	github.com/coreos/go-oidc v2.1.0+incompatible
 	github.com/gorilla/mux v1.8.0
+	github.com/gorilla/sessions v1.2.1
+	github.com/pmezard/go-difflib v1.0.0
 	golang.org/x/oauth2 v0.4.0
 	helm.sh/helm/v3 v3.12.2
 	k8s.io/api v0.27.3
@@ -12,6 +14,7 @@ require (
 	k8s.io/cli-runtime v0.27.2
 	k8s.io/client-go v0.27.3
 	k8s.io/klog/v2 v2.90.1
+	sigs.k8s.io/yaml v1.3.0
 )
 
 require (
@@ -58,7 +61,6 @@ require (
 	github.com/google/shlex v0.0.0-20191202100458-e7afc7fbc510 // indirect
 	github.com/google/uuid v1.3.0 // indirect
 	github.com/gorilla/securecookie v1.1.1 // indirect
-	github.com/gorilla/sessions v1.2.1 // indirect
 	github.com/gosuri/uitable v0.0.4 // indirect
 	github.com/gregjones/httpcache v0.0.0-20180305231024-9cad4c3443a7 // indirect
 	github.com/hashicorp/errwrap v1.1.0 // indirect
@@ -140,5 +142,4 @@ require (
 	sigs.k8s.io/kustomize/api v0.13.2 // indirect
 	sigs.k8s.io/kustomize/kyaml v0.14.1 // indirect
 	sigs.k8s.io/structured-merge-diff/v4 v4.2.3 // indirect
-	sigs.k8s.io/yaml v1.3.0 // indirect
 )
@@ -0,0 +1,392 @@
+package handlers
+
+import (
+	"compareapp/diff"
+	"compareapp/k8s"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// JSON API (/api/v1) does the same as the pages but without the comparison
+// session: every request names kubeconfig source, clusters and namespaces itself.
+// Only "internal" (./conf/kubeconfig) and "home" (~/.kube/config) sources are
+// available, uploaded kubeconfigs live in the browser session only. Snapshots
+// ("snapshot:<name>") and manifest directories ("manifests:<name>") are clusters
+// of every source.
+
+// snapshot names are file names in the snapshot directory
+var snapshotNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+type apiCluster struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+}
+
+type apiKind struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Related     []string `json:"related,omitempty"`
+	IgnoreRules []string `json:"ignoreRules,omitempty"`
+}
+
+// CompareRequest is the body of POST /api/v1/compare
+type CompareRequest struct {
+	Source      string   `json:"source"`
+	Cluster1    string   `json:"cluster1"`
+	Cluster2    string   `json:"cluster2"`
+	Namespaces1 []string `json:"namespaces1"`
+	Namespaces2 []string `json:"namespaces2"`
+	// NamespaceMapping is the same as the mapping on the namespaces page
+	NamespaceMapping map[string]string `json:"namespaceMapping"`
+	// Kinds are kind ids (GET /api/v1/kinds), empty means all kinds
+	Kinds []string `json:"kinds"`
+}
+
+// MatrixRequest is the body of POST /api/v1/matrix
+type MatrixRequest struct {
+	Source string `json:"source"`
+	// Clusters are columns of the matrix in order, e.g. dev, stage, preprod, prod
+	Clusters []string `json:"clusters"`
+	// Namespaces are compared under the same name in all clusters
+	Namespaces []string `json:"namespaces"`
+	// NamespaceGroups are namespaces with different names, one namespace per cluster in each group
+	NamespaceGroups [][]string `json:"namespaceGroups"`
+	// Kinds are kind ids (GET /api/v1/kinds), empty means all kinds
+	Kinds []string `json:"kinds"`
+}
+
+// SnapshotRequest is the body of POST /api/v1/snapshots
+type SnapshotRequest struct {
+	Source  string `json:"source"`
+	Cluster string `json:"cluster"`
+	// Name of the snapshot, "<cluster>-<time>" by default
+	Name string `json:"name"`
+	// Namespaces to capture, empty means all namespaces
+	Namespaces []string `json:"namespaces"`
+	// Kinds are kind ids (GET /api/v1/kinds), empty means all kinds
+	Kinds []string `json:"kinds"`
+}
+
+// CompareResponse is the result of POST /api/v1/compare
+type CompareResponse struct {
+	Cluster1       string               `json:"cluster1"`
+	Cluster2       string               `json:"cluster2"`
+	NamespacePairs []diff.NamespacePair `json:"namespacePairs"`
+	Results        []diff.Result        `json:"results"`
+}
+
+// MatrixResponse is the result of POST /api/v1/matrix
+type MatrixResponse struct {
+	Clusters []string            `json:"clusters"`
+	Results  []diff.MatrixResult `json:"results"`
+}
+
+// APIClustersHandler lists clusters (kubeconfig contexts) of the source
+func APIClustersHandler(w http.ResponseWriter, r *http.Request) {
+	source := apiSource(r.URL.Query().Get("source"))
+	configPaths, err := apiConfigPaths(source)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	clusters := make([]apiCluster, 0, len(configPaths))
+	for name := range configPaths {
+		clusters = append(clusters, apiCluster{Name: name, Source: source})
+	}
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i].Name < clusters[j].Name })
+	writeAPIResponse(w, http.StatusOK, map[string]interface{}{"clusters": clusters})
+}
+
+// APINamespacesHandler lists namespaces of the cluster
+func APINamespacesHandler(w http.ResponseWriter, r *http.Request) {
+	cluster := mux.Vars(r)["cluster"]
+	configPaths, err := apiConfigPaths(apiSource(r.URL.Query().Get("source")))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	kubeconfig, ok := configPaths[cluster]
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("cluster %q not found", cluster))
+		return
+	}
+	namespaces, err := k8s.FillNamespaces(r.Context(), cluster, kubeconfig)
+	if err != nil {
+		writeAPIError(w, http.StatusBadGateway, err)
+		return
+	}
+	writeAPIResponse(w, http.StatusOK, map[string]interface{}{"cluster": cluster, "namespaces": namespaces})
+}
+
+// APIKindsHandler lists resource kinds which can be compared
+func APIKindsHandler(w http.ResponseWriter, r *http.Request) {
+	kinds := []apiKind{}
+	for _, kind := range diff.Kinds() {
+		item := apiKind{ID: kind.ID, Name: kind.Name, Related: kind.Related}
+		for _, rule := range kind.Rules() {
+			item.IgnoreRules = append(item.IgnoreRules, rule.String())
+		}
+		kinds = append(kinds, item)
+	}
+	writeAPIResponse(w, http.StatusOK, map[string]interface{}{"kinds": kinds})
+}
+
+// APICompareHandler compares kinds in two clusters from a single JSON request
+func APICompareHandler(w http.ResponseWriter, r *http.Request) {
+	var req CompareRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err))
+		return
+	}
+
+	configPaths, err := apiConfigPaths(apiSource(req.Source))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	kubeconfig1, ok1 := configPaths[req.Cluster1]
+	kubeconfig2, ok2 := configPaths[req.Cluster2]
+	if !ok1 || !ok2 {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("unknown cluster, see GET /api/v1/clusters"))
+		return
+	}
+	pairs := diff.PairNamespaces(req.Namespaces1, req.Namespaces2, req.NamespaceMapping)
+	if len(pairs) == 0 {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("namespaces1 is required"))
+		return
+	}
+
+	kinds, err := apiKinds(req.Kinds)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	sides := make([][2]diff.Side, 0, len(pairs))
+	for _, pair := range pairs {
+		side1, side2 := pair.Sides(req.Cluster1, kubeconfig1, req.Cluster2, kubeconfig2)
+		sides = append(sides, [2]diff.Side{side1, side2})
+	}
+
+	// kinds are compared one after another, calls of every kind run concurrently
+	// within the parallelism limit of one request
+	results := make([]diff.Result, len(kinds))
+	for i, kind := range kinds {
+		results[i], err = diff.Compare(r.Context(), kind, sides)
+		if err != nil {
+			return // request is cancelled
+		}
+	}
+
+	writeAPIResponse(w, http.StatusOK, CompareResponse{
+		Cluster1:       req.Cluster1,
+		Cluster2:       req.Cluster2,
+		NamespacePairs: pairs,
+		Results:        results,
+	})
+}
+
+// APIMatrixHandler compares kinds in N clusters at once, every field which differs
+// somewhere is returned with its value in every cluster
+func APIMatrixHandler(w http.ResponseWriter, r *http.Request) {
+	var req MatrixRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err))
+		return
+	}
+	if len(req.Clusters) < 2 {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("at least two clusters are required"))
+		return
+	}
+
+	configPaths, err := apiConfigPaths(apiSource(req.Source))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	kubeconfigs := make([]string, len(req.Clusters))
+	for i, cluster := range req.Clusters {
+		kubeconfig, ok := configPaths[cluster]
+		if !ok {
+			writeAPIError(w, http.StatusBadRequest, fmt.Errorf("unknown cluster %q, see GET /api/v1/clusters", cluster))
+			return
+		}
+		kubeconfigs[i] = kubeconfig
+	}
+
+	namespaceGroups := req.NamespaceGroups
+	for _, ns := range req.Namespaces {
+		group := make([]string, len(req.Clusters))
+		for i := range group {
+			group[i] = ns
+		}
+		namespaceGroups = append(namespaceGroups, group)
+	}
+	if len(namespaceGroups) == 0 {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("namespaces or namespaceGroups is required"))
+		return
+	}
+	groups := make([][]diff.Side, 0, len(namespaceGroups))
+	for _, namespaces := range namespaceGroups {
+		if len(namespaces) != len(req.Clusters) {
+			writeAPIError(w, http.StatusBadRequest, fmt.Errorf("namespace group %v must have a namespace per cluster", namespaces))
+			return
+		}
+		group := make([]diff.Side, len(namespaces))
+		for i, ns := range namespaces {
+			group[i] = diff.Side{Cluster: req.Clusters[i], Kubeconfig: kubeconfigs[i], Namespace: ns}
+		}
+		groups = append(groups, group)
+	}
+
+	kinds, err := apiKinds(req.Kinds)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// kinds one after another, see APICompareHandler
+	results := make([]diff.MatrixResult, len(kinds))
+	for i, kind := range kinds {
+		results[i], err = diff.CompareMatrix(r.Context(), kind, groups)
+		if err != nil {
+			return // request is cancelled
+		}
+	}
+
+	writeAPIResponse(w, http.StatusOK, MatrixResponse{Clusters: req.Clusters, Results: results})
+}
+
+// APISnapshotsHandler lists snapshots of the snapshot directory
+func APISnapshotsHandler(w http.ResponseWriter, r *http.Request) {
+	snapshots := []apiSnapshot{}
+	for name, configPath := range k8s.SetClusterConfigSnapshots() {
+		snapshot, err := k8s.OpenSnapshot(configPath)
+		if err != nil {
+			log.Println("Failed to open snapshot:", err)
+			continue
+		}
+		snapshots = append(snapshots, apiSnapshot{Name: name, SnapshotManifest: snapshot.Manifest})
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Name < snapshots[j].Name })
+	writeAPIResponse(w, http.StatusOK, map[string]interface{}{"snapshots": snapshots})
+}
+
+// APICaptureSnapshotHandler saves kinds of the cluster into the snapshot directory
+func APICaptureSnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	var req SnapshotRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err))
+		return
+	}
+
+	configPaths, err := apiConfigPaths(apiSource(req.Source))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+	kubeconfig, ok := configPaths[req.Cluster]
+	if !ok {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("unknown cluster, see GET /api/v1/clusters"))
+		return
+	}
+	if req.Name == "" {
+		req.Name = strings.NewReplacer(":", "-", "/", "-").Replace(req.Cluster) + "-" + time.Now().UTC().Format("20060102-150405")
+	}
+	if !snapshotNameRe.MatchString(req.Name) {
+		writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid snapshot name %q", req.Name))
+		return
+	}
+	if _, ok := k8s.SetClusterConfigSnapshots()["snapshot:"+req.Name]; ok {
+		writeAPIError(w, http.StatusConflict, fmt.Errorf("snapshot %q already exists", req.Name))
+		return
+	}
+	kinds, err := apiKinds(req.Kinds)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	path := filepath.Join(k8s.SnapshotDir(), req.Name+".tar.gz")
+	manifest, statuses, err := diff.Capture(r.Context(), req.Cluster, kubeconfig, req.Namespaces, kinds, path)
+	if err != nil {
+		writeAPIError(w, http.StatusBadGateway, err)
+		return
+	}
+	if statuses == nil {
+		statuses = []diff.Status{}
+	}
+	writeAPIResponse(w, http.StatusCreated, map[string]interface{}{
+		"snapshot": apiSnapshot{Name: "snapshot:" + req.Name, SnapshotManifest: manifest},
+		"errors":   statuses,
+	})
+}
+
+type apiSnapshot struct {
+	Name string `json:"name"`
+	k8s.SnapshotManifest
+}
+
+// apiKinds returns kinds by ids, all kinds for empty list
+func apiKinds(ids []string) ([]diff.Kind, error) {
+	if len(ids) == 0 {
+		return diff.DefaultKinds(), nil
+	}
+	var kinds []diff.Kind
+	for _, id := range ids {
+		kind, ok := diff.KindByID(id)
+		if !ok {
+			return nil, fmt.Errorf("unknown kind %q, see GET /api/v1/kinds", id)
+		}
+		kinds = append(kinds, kind)
+	}
+	return kinds, nil
+}
+
+func apiSource(source string) string {
+	if source == "" {
+		return "internal"
+	}
+	return source
+}
+
+func apiConfigPaths(source string) (map[string]string, error) {
+	switch source {
+	case "internal":
+		return withOfflineSources(k8s.SetClusterConfig()), nil
+	case "home":
+		return withOfflineSources(k8s.SetClusterConfigHome()), nil
+	}
+	return nil, fmt.Errorf("unknown source %q, expected internal or home", source)
+}
+
+func writeAPIResponse(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("Failed to write API response:", err)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, code int, err error) {
+	body := map[string]interface{}{"error": err.Error()}
+	if reason := k8s.ReasonOf(err); reason != k8s.ReasonUnknown {
+		body["reason"] = reason
+	}
+	writeAPIResponse(w, code, body)
+}
@@ -2,41 +2,39 @@ package handlers
 
 import (
 	"compareapp/diff"
-	"compareapp/helm"
 	"compareapp/k8s"
+	"compareapp/state"
+	"context"
 	"encoding/json"
 	"fmt"
 	"html/template"
+	"io"
 	"log"
 	"net/http"
 	"path/filepath"
+	"sort"
+	"sync/atomic"
 
+	"github.com/gorilla/mux"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-var compar string
-var selectedConfig string
-var configPaths map[string]string
-var Kubeconfig1, Kubeconfig2 string
-var Cluster1, Cluster2 string
-var Namespaces1, Namespaces2 []string
-var Namespace1, Namespace2 string
-var Resources []string
-var ClusterVersion1, ClusterVersion2 interface{}
-var ConfigType string
-
 type aboutCluster struct {
-	Cluster1    string
-	Cluster2    string
-	Kubeconfig1 string
-	Kubeconfig2 string
-	Namespaces1 []string
-	Namespaces2 []string
-	Namespace1  string
-	Namespace2  string
-	Resources   []string
+	Cluster1       string
+	Cluster2       string
+	Kubeconfig1    string
+	Kubeconfig2    string
+	ExtraClusters  []string
+	Namespaces1    []string
+	Namespaces2    []string
+	Namespace1     string
+	Namespace2     string
+	NamespacePairs []diff.NamespacePair
+	Resources      []string
+	Kinds          []pickerKind
+	Errors         []string
 }
 
 type tableInfra struct {
@@ -55,23 +53,46 @@ type tableInfra struct {
 	FlaggerNum  int
 	Gatekeeper  string
 	Jaeger      string
+	Errors      []string
+}
+
+// SessionHandlerFunc is a page handler working on the comparison session of the current user
+type SessionHandlerFunc func(w http.ResponseWriter, r *http.Request, s *state.Session)
+
+// WithSession loads (or creates) the comparison session of the user and passes it to the handler.
+// Handlers read a copy of the selection and change it with Update, the session is
+// not locked while clusters are called.
+func WithSession(store *state.Store, h SessionHandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s, err := store.Get(w, r)
+		if err != nil {
+			http.Error(w, "Failed to load comparison session: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer store.Release(s)
+		h(w, r, s)
+	}
 }
 
-func IndexHandler(w http.ResponseWriter, r *http.Request) {
+func IndexHandler(w http.ResponseWriter, r *http.Request, s *state.Session) {
 	err := r.ParseMultipartForm(10 << 20) // Максимум 10 MB файлов
 	if err != nil {
 		fmt.Print("error reading values in IndexHandler: ", err)
 		http.Redirect(w, r, "/select_config", http.StatusSeeOther)
 		return
 	}
-	selectedConfig = r.FormValue("connectionSelect")
+	selectedConfig := r.FormValue("connectionSelect")
 	if selectedConfig == "" {
 		http.Redirect(w, r, "/select_config", http.StatusSeeOther)
 
 	} else {
 		if selectedConfig == "internal" {
-			ConfigType = selectedConfig
-			configPaths = k8s.SetClusterConfig()
+			s.Reset() // wipe selection and uploaded kubeconfigs of previous comparison
+			configPaths := withOfflineSources(k8s.SetClusterConfig())
+			s.Update(func(sel *state.Selection) {
+				sel.ConfigType = selectedConfig
+				sel.ConfigPaths = configPaths
+			})
 			// Вывод глаыной странички из темплейта
 			err := renderPage(w, "templates/index.html", configPaths)
 			if err != nil {
@@ -79,31 +100,46 @@ func IndexHandler(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 		} else if selectedConfig == "external" {
-			ConfigType = selectedConfig
-			file1, handler1, err := r.FormFile("cluster1Input")
+			s.Reset() // wipe previously uploaded kubeconfigs
+			var uploaded []string
+			for _, input := range []string{"cluster1Input", "cluster2Input"} {
+				configPath, err := uploadKubeconfig(r, input)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				if configPath == "" {
+					continue
+				}
+				uploaded = append(uploaded, configPath)
+				s.OnReset(func() { k8s.ForgetMemoryConfig(configPath) })
+			}
+			if len(uploaded) == 0 {
+				http.Error(w, "No kubeconfig files uploaded", http.StatusBadRequest)
+				return
+			}
+			configPaths, err := k8s.SetClusterConfigExternal(uploaded...)
 			if err != nil {
-				fmt.Println("Error Retrieving the File1")
-				fmt.Println(err)
+				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
 			}
-			defer file1.Close()
-			fmt.Printf("Uploaded File: %+v\n", handler1.Filename)
-			fmt.Printf("File Size: %+v\n", handler1.Size)
-			fmt.Printf("MIME Header: %+v\n", handler1.Header)
-
-			file2, handler2, err := r.FormFile("cluster2Input")
+			configPaths = withOfflineSources(configPaths)
+			s.Update(func(sel *state.Selection) {
+				sel.ConfigType = selectedConfig
+				sel.ConfigPaths = configPaths
+			})
+			err = renderPage(w, "templates/index.html", configPaths)
 			if err != nil {
-				fmt.Println("Error Retrieving the File2")
-				fmt.Println(err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
-			defer file2.Close()
-			fmt.Printf("Uploaded File: %+v\n", handler2.Filename)
-			fmt.Printf("File Size: %+v\n", handler2.Size)
-			fmt.Printf("MIME Header: %+v\n", handler2.Header)
 		} else if selectedConfig == "home" {
-			ConfigType = selectedConfig
-			configPaths = k8s.SetClusterConfigHome()
+			s.Reset()
+			configPaths := withOfflineSources(k8s.SetClusterConfigHome())
+			s.Update(func(sel *state.Selection) {
+				sel.ConfigType = selectedConfig
+				sel.ConfigPaths = configPaths
+			})
 			// Вывод глаыной странички из темплейта
 			err := renderPage(w, "templates/index.html", configPaths)
 			if err != nil {
@@ -114,18 +150,53 @@ func IndexHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func SelectConfigHandler(w http.ResponseWriter, r *http.Request) {
+// withOfflineSources adds snapshots and manifest directories to the cluster picker,
+// so any side of the comparison can be a live cluster, a snapshot or git manifests
+func withOfflineSources(configPaths map[string]string) map[string]string {
+	for name, configPath := range k8s.SetClusterConfigSnapshots() {
+		configPaths[name] = configPath
+	}
+	for name, configPath := range k8s.SetClusterConfigManifests() {
+		configPaths[name] = configPath
+	}
+	return configPaths
+}
+
+// uploadKubeconfig reads kubeconfig file from the form and keeps it in memory only,
+// empty path returned when the file is not selected in the form
+func uploadKubeconfig(r *http.Request, input string) (string, error) {
+	file, handler, err := r.FormFile(input)
+	if err == http.ErrMissingFile {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error retrieving uploaded kubeconfig %s: %v", input, err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return "", fmt.Errorf("error reading uploaded kubeconfig %s: %v", handler.Filename, err)
+	}
+	configPath, err := k8s.RegisterMemoryConfig(data)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", handler.Filename, err)
+	}
+	return configPath, nil
+}
+
+func SelectConfigHandler(w http.ResponseWriter, r *http.Request, s *state.Session) {
 
 	// Вывод глаыной странички из темплейта
-	err := renderPage(w, "templates/pre_index.html", configPaths)
+	err := renderPage(w, "templates/pre_index.html", s.Selection().ConfigPaths)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 }
 
-func ClearSelectHandler(w http.ResponseWriter, r *http.Request) {
-	selectedConfig = ""
+func ClearSelectHandler(w http.ResponseWriter, r *http.Request, s *state.Session) {
+	s.Reset()
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
@@ -147,8 +218,9 @@ func renderPage(w http.ResponseWriter, page string, data interface{}) error {
 
 func renderCanaryPage(w http.ResponseWriter, page string, data interface{}) error {
 	t, err := template.New(filepath.Base(page)).Funcs(template.FuncMap{
-		"formatAsJSON":       formatAsJSON,
-		"UnstructuredToJSON": UnstructuredToJSON,
+		"formatAsJSON":           formatAsJSON,
+		"UnstructuredToJSON":     UnstructuredToJSON,
+		"fingerprintsComparable": diff.FingerprintsComparable,
 	}).ParseFiles(page)
 
 	if err != nil {
@@ -197,25 +269,52 @@ func formatAsJSON(s string) template.HTML {
 	return template.HTML(formatted)
 }
 
-func NamespaceHandler(w http.ResponseWriter, r *http.Request) {
+func NamespaceHandler(w http.ResponseWriter, r *http.Request, s *state.Session) {
+	sel := s.Selection()
 
 	// Получаем имена выбранных кластеров из веб формы странички
-	Cluster1 = r.FormValue("cluster1")
-	Cluster2 = r.FormValue("cluster2")
+	sel.Cluster1 = r.FormValue("cluster1")
+	sel.Cluster2 = r.FormValue("cluster2")
+	// остальные кластеры сравниваются только на странице матрицы
+	sel.ExtraClusters = nil
+	for _, cluster := range r.Form["clusters"] {
+		if _, ok := sel.ConfigPaths[cluster]; !ok {
+			continue
+		}
+		if !containsString(sel.Clusters(), cluster) {
+			sel.ExtraClusters = append(sel.ExtraClusters, cluster)
+		}
+	}
 
 	// Получаем неймспейсы и кубконфиги для выбранных кластеров.
-	Kubeconfig1 = configPaths[Cluster1]
-	Kubeconfig2 = configPaths[Cluster2]
-	Namespaces1 := k8s.FillNamespaces(Cluster1, Kubeconfig1)
-	Namespaces2 := k8s.FillNamespaces(Cluster2, Kubeconfig2)
-	//Namespaces1 = clusterNamespaces[Cluster1]
-	//Namespaces2 = clusterNamespaces[Cluster2]
+	sel.Kubeconfig1 = sel.ConfigPaths[sel.Cluster1]
+	sel.Kubeconfig2 = sel.ConfigPaths[sel.Cluster2]
+	plan := k8s.NewPlan(r.Context())
+	plan.Go("namespaces of "+sel.Cluster1, func(ctx context.Context) (err error) {
+		sel.Namespaces1, err = k8s.FillNamespaces(ctx, sel.Cluster1, sel.Kubeconfig1)
+		return err
+	})
+	plan.Go("namespaces of "+sel.Cluster2, func(ctx context.Context) (err error) {
+		sel.Namespaces2, err = k8s.FillNamespaces(ctx, sel.Cluster2, sel.Kubeconfig2)
+		return err
+	})
+	errs := plan.Wait()
+	s.Update(func(current *state.Selection) {
+		current.Cluster1, current.Cluster2 = sel.Cluster1, sel.Cluster2
+		current.Kubeconfig1, current.Kubeconfig2 = sel.Kubeconfig1, sel.Kubeconfig2
+		current.ExtraClusters = sel.ExtraClusters
+		current.Namespaces1, current.Namespaces2 = sel.Namespaces1, sel.Namespaces2
+	})
+	if logCallErrors(r, errs) {
+		return
+	}
 
 	data := aboutCluster{
-		Cluster1:    Cluster1,
-		Cluster2:    Cluster2,
-		Namespaces1: Namespaces1,
-		Namespaces2: Namespaces2,
+		Cluster1:    sel.Cluster1,
+		Cluster2:    sel.Cluster2,
+		Namespaces1: sel.Namespaces1,
+		Namespaces2: sel.Namespaces2,
+		Errors:      errorMessages(errs),
 	}
 
 	// Формируем страницу из шаблона для выбора неймспейса
@@ -226,857 +325,454 @@ func NamespaceHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func ResourceHandler(w http.ResponseWriter, r *http.Request) {
-	Namespace1 = r.FormValue("namespace1")
-	Namespace2 = r.FormValue("namespace2")
-	Resources = nil // set to null every time when page requested
-	Resources = append(Resources, "ClusterInfra")
-	Resources = append(Resources, "HelmValues")
-	canaryNum1, ingNum1 := k8s.GetPerCluster(Cluster1, Kubeconfig1)
-	canaryNum2, ingNum2 := k8s.GetPerCluster(Cluster2, Kubeconfig2)
-	deployNum1 := len(k8s.GetDeployPerNs(Cluster1, Kubeconfig1, Namespace1))
-	deployNum2 := len(k8s.GetDeployPerNs(Cluster2, Kubeconfig2, Namespace2))
-	daemonSet1 := len(k8s.GetUniversalObjectPerNsAsString(Cluster1, Kubeconfig1, Namespace1, "apps", "v1", "daemonsets"))
-	daemonSet2 := len(k8s.GetUniversalObjectPerNsAsString(Cluster2, Kubeconfig2, Namespace2, "apps", "v1", "daemonsets"))
-	if deployNum1 >= 1 || deployNum2 >= 1 {
-		Resources = append(Resources, "Deployments")
-	}
-	if daemonSet1 >= 1 || daemonSet2 >= 1 {
-		Resources = append(Resources, "Daemonsets")
+func ResourceHandler(w http.ResponseWriter, r *http.Request, s *state.Session) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	if canaryNum1 >= 1 || canaryNum2 >= 1 {
-		Resources = append(Resources, "Flagger (Canary)")
+	sel := s.Selection()
+	// several namespaces can be compared at once, counterparts in the second cluster
+	// are taken from the mapping ("foo-stage=foo") or have the same names
+	mapping, err := diff.ParseNamespaceMapping(r.FormValue("namespaceMapping"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	if ingNum1 >= 1 || ingNum2 >= 1 {
-		Resources = append(Resources, "IngressRoutes (Traefik)")
+	sel.NamespacePairs = diff.PairNamespaces(r.Form["namespace1"], r.Form["namespace2"], mapping)
+	if len(sel.NamespacePairs) == 0 {
+		http.Error(w, "Select at least one namespace in the first cluster", http.StatusBadRequest)
+		return
 	}
-	Resources = append(Resources, "Services")
+	sel.Namespace1 = sel.NamespacePairs[0].Namespace1
+	sel.Namespace2 = sel.NamespacePairs[0].Namespace2
 
-	data := aboutCluster{
-		Cluster1:   Cluster1,
-		Cluster2:   Cluster2,
-		Namespace1: Namespace1,
-		Namespace2: Namespace2,
-		Resources:  Resources,
+	sel.Resources = nil // set to null every time when page requested
+	sel.Resources = append(sel.Resources, "ClusterInfra")
+	sel.Resources = append(sel.Resources, "HelmValues")
+	sel.Resources = append(sel.Resources, "HelmReleases")
+	// cluster wide kinds (helm releases of all namespaces, cluster scoped resources)
+	// are not found by discovery of namespaced resources
+	for _, kind := range diff.Kinds() {
+		if kind.ClusterWide {
+			sel.Resources = append(sel.Resources, kind.Name)
+		}
 	}
-	err := renderPage(w, "templates/resources.html", data)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+	// resources of both clusters are found by api discovery, objects of every
+	// resource are counted in the selected namespaces of both clusters
+	var clusterVersion1, clusterVersion2 interface{}
+	var resources1, resources2 []k8s.APIResource
+	plan := k8s.NewPlan(r.Context())
+	plan.Go("version of "+sel.Cluster1, func(ctx context.Context) (err error) {
+		clusterVersion1, err = k8s.ClusterVersion(ctx, sel.Cluster1, sel.Kubeconfig1, false)
+		return err
+	})
+	plan.Go("version of "+sel.Cluster2, func(ctx context.Context) (err error) {
+		clusterVersion2, err = k8s.ClusterVersion(ctx, sel.Cluster2, sel.Kubeconfig2, false)
+		return err
+	})
+	plan.Go("api resources of "+sel.Cluster1, func(ctx context.Context) (err error) {
+		resources1, err = k8s.NamespacedResources(ctx, sel.Cluster1, sel.Kubeconfig1)
+		return err
+	})
+	plan.Go("api resources of "+sel.Cluster2, func(ctx context.Context) (err error) {
+		resources2, err = k8s.NamespacedResources(ctx, sel.Cluster2, sel.Kubeconfig2)
+		return err
+	})
+	warnings := plan.Wait()
+	if logCallErrors(r, warnings) {
 		return
 	}
-	var clusterVersion1, clusterVersion2 interface{}
-	clusterVersion1, err = k8s.ClusterVersion(Cluster1, Kubeconfig1, false)
-	if err != nil {
-		log.Println("Failed to get version for", Cluster1, err)
+	if version, ok := clusterVersion1.(string); ok {
+		sel.ClusterVersion1 = version
+	}
+	if version, ok := clusterVersion2.(string); ok {
+		sel.ClusterVersion2 = version
+	}
+	s.Update(func(current *state.Selection) {
+		current.NamespacePairs = sel.NamespacePairs
+		current.Namespace1, current.Namespace2 = sel.Namespace1, sel.Namespace2
+		current.Resources = sel.Resources
+		current.ClusterVersion1, current.ClusterVersion2 = sel.ClusterVersion1, sel.ClusterVersion2
+	})
+
+	kinds := pickerKinds(resources1, resources2)
+	plan = k8s.NewPlan(r.Context())
+	for i := range kinds {
+		kind := &kinds[i]
+		for _, pair := range sel.NamespacePairs {
+			side1, side2 := sel.Sides(pair)
+			for _, count := range []struct {
+				side   diff.Side
+				num    *int64
+				failed *int32
+			}{{side1, &kind.Count1, &kind.failed1}, {side2, &kind.Count2, &kind.failed2}} {
+				count, gvr := count, kind.Kind.GVR
+				plan.Go(kind.Kind.Name+" in "+count.side.Cluster+"/"+count.side.Namespace, func(ctx context.Context) error {
+					num, err := k8s.CountPerNamespace(ctx, count.side.Cluster, count.side.Kubeconfig, count.side.Namespace, gvr.Group, gvr.Version, gvr.Resource)
+					atomic.AddInt64(count.num, int64(num))
+					// CRD missing in a cluster is not an error for the resource picker
+					if err != nil && !k8s.IsNotInstalled(err) {
+						atomic.StoreInt32(count.failed, 1)
+						return err
+					}
+					return nil
+				})
+			}
+		}
+	}
+	errs := plan.Wait()
+	if logCallErrors(r, errs) {
 		return
 	}
+	// resources which could not be counted stay in the picker, so the report
+	// tells what could not be read
+	warnings = append(warnings, errs...)
+	for i := range kinds {
+		kinds[i].Failed1, kinds[i].Failed2 = kinds[i].failed1 != 0, kinds[i].failed2 != 0
+	}
 
-	clusterVersion2, err = k8s.ClusterVersion(Cluster2, Kubeconfig2, false)
+	data := aboutCluster{
+		Cluster1:       sel.Cluster1,
+		Cluster2:       sel.Cluster2,
+		ExtraClusters:  sel.ExtraClusters,
+		Namespace1:     sel.Namespace1,
+		Namespace2:     sel.Namespace2,
+		NamespacePairs: sel.NamespacePairs,
+		Resources:      sel.Resources,
+		Kinds:          kinds,
+		Errors:         errorMessages(warnings),
+	}
+	err = renderPage(w, "templates/resources.html", data)
 	if err != nil {
-		log.Println("Failed to get version for", Cluster2, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	ClusterVersion1 = clusterVersion1.(string)
-	ClusterVersion2 = clusterVersion2.(string)
 }
 
-func CompareClusterHandler(w http.ResponseWriter, r *http.Request) {
-	compar = r.FormValue("resource")
+// pickerKind is a resource of the resource picker with number of objects in the
+// selected namespaces of both clusters
+type pickerKind struct {
+	Kind diff.Kind
+	// APIKind is shown next to resources without registered kind ("Ingress")
+	APIKind        string
+	Count1, Count2 int64
+	// Failed1 and Failed2 are true when objects could not be counted
+	Failed1, Failed2 bool
+	failed1, failed2 int32
+}
 
-	if compar == "ClusterInfra" {
-		var tableData []tableInfra
-		tableData = make([]tableInfra, 0)
-		nodeCount1, cpuTotal1, memTotal1, diskTotal1, podsTotal1, _ := k8s.GetNodesInfo(Cluster1, Kubeconfig1)
-		nodeCount2, cpuTotal2, memTotal2, diskTotal2, podsTotal2, _ := k8s.GetNodesInfo(Cluster2, Kubeconfig2)
-		nsCount1, nsCount2 := len(Namespaces1), len(Namespaces2)
-		var apiNums1, apiNums2 int
-		var apiresources1, apiresources2 *metav1.APIGroupList
-		apiNums1, apiresources1, _ = k8s.GetAPIinfo(Cluster1, Kubeconfig1)
-		apiNums2, apiresources2, _ = k8s.GetAPIinfo(Cluster2, Kubeconfig2)
-		// проверяем формат значения возвращенного в версии кластера поскольку стоит {intarface}
-		str1 := ClusterVersion1.(string)
-		str2 := ClusterVersion2.(string)
-		var traefikStatus1 string = "Not Installed"
-		for _, group := range apiresources1.Groups {
-			for _, version := range group.Versions {
-				if version.GroupVersion == "traefik.containo.us/v1alpha1" {
-					traefikStatus1 = "Installed"
-					break
-				}
-			}
-		}
-		var traefikStatus2 string = "Not Installed"
-		for _, group := range apiresources2.Groups {
-			for _, version := range group.Versions {
-				if version.GroupVersion == "traefik.containo.us/v1alpha1" {
-					traefikStatus2 = "Installed"
-					break
-				}
-			}
-		}
-		var canaryStatus1 string = "Not Installed"
-		for _, group := range apiresources1.Groups {
-			for _, version := range group.Versions {
-				if version.GroupVersion == "flagger.app/v1beta1" {
-					canaryStatus1 = "Installed"
-					break
-				}
-			}
+// pickerKinds returns kinds of resources served by any of the clusters:
+// registered kinds first, then resources compared by the generic diff
+func pickerKinds(resources ...[]k8s.APIResource) []pickerKind {
+	var registered, generic []pickerKind
+	seen := make(map[string]bool)
+	for _, list := range resources {
+		for _, resource := range list {
+			key := resource.Group + "/" + resource.Resource
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			// registered kinds are read in the version preferred by the cluster
+			kind := diff.KindOf(resource.GVR())
+			if kind.Registered() {
+				registered = append(registered, pickerKind{Kind: kind})
+			} else {
+				generic = append(generic, pickerKind{Kind: kind, APIKind: resource.Kind})
+			}
+		}
+	}
+	order := make(map[string]int)
+	for i, kind := range diff.Kinds() {
+		order[kind.ID] = i
+	}
+	sort.SliceStable(registered, func(i, j int) bool {
+		return order[registered[i].Kind.RegistryID()] < order[registered[j].Kind.RegistryID()]
+	})
+	return append(registered, generic...)
+}
+
+// pickedKind returns kind selected in the resource picker: registered kinds are
+// picked by name, resources found by discovery by id
+func pickedKind(resource string) (diff.Kind, bool) {
+	if kind, ok := diff.KindByName(resource); ok {
+		return kind, true
+	}
+	return diff.KindByID(resource)
+}
+
+func CompareClusterHandler(w http.ResponseWriter, r *http.Request, s *state.Session) {
+	resource := r.FormValue("resource")
+	s.Update(func(sel *state.Selection) { sel.Compare = resource })
+	sel := s.Selection()
+
+	if resource == "ClusterInfra" {
+		tableData := []tableInfra{
+			{ClusterName: sel.Cluster1, KubeVersion: sel.ClusterVersion1, NsCount: len(sel.Namespaces1)},
+			{ClusterName: sel.Cluster2, KubeVersion: sel.ClusterVersion2, NsCount: len(sel.Namespaces2)},
+		}
+		kubeconfigs := []string{sel.Kubeconfig1, sel.Kubeconfig2}
+		apiresources := make([]*metav1.APIGroupList, len(tableData))
+
+		// nodes, pods, discovery and CRDs of both clusters are fetched concurrently
+		plan := k8s.NewPlan(r.Context())
+		for i := range tableData {
+			i, t, cluster, kubeconfig := i, &tableData[i], tableData[i].ClusterName, kubeconfigs[i]
+			plan.Go("nodes of "+cluster, func(ctx context.Context) (err error) {
+				t.NodeCount, t.CpuTotal, t.MemTotal, t.DiskTotal, err = k8s.GetNodesInfo(ctx, cluster, kubeconfig)
+				return err
+			})
+			plan.Go("pods of "+cluster, func(ctx context.Context) (err error) {
+				t.PodTotal, err = k8s.CountPods(ctx, cluster, kubeconfig)
+				return err
+			})
+			plan.Go("api resources of "+cluster, func(ctx context.Context) (err error) {
+				t.ApiNums, apiresources[i], err = k8s.GetAPIinfo(ctx, cluster, kubeconfig)
+				return err
+			})
+			plan.Go("canaries of "+cluster, func(ctx context.Context) (err error) {
+				t.FlaggerNum, err = k8s.CountPerCluster(ctx, cluster, kubeconfig, "flagger.app", "v1beta1", "canaries")
+				return err
+			})
+			plan.Go("ingressroutes of "+cluster, func(ctx context.Context) (err error) {
+				t.TraefikNum, err = k8s.CountPerCluster(ctx, cluster, kubeconfig, "traefik.containo.us", "v1alpha1", "ingressroutes")
+				return err
+			})
+		}
+		errs := plan.Wait()
+		if logCallErrors(r, errs) {
+			return
 		}
-		var canaryStatus2 string = "Not Installed"
-		for _, group := range apiresources2.Groups {
-			for _, version := range group.Versions {
-				if version.GroupVersion == "flagger.app/v1beta1" {
-					canaryStatus2 = "Installed"
-					break
-				}
+		for _, err := range errs {
+			if k8s.IsNotInstalled(err.Err) {
+				continue // shown as "Not Installed"
 			}
-		}
-		var jaegerStatus1 string = "Not Installed"
-		for _, group := range apiresources1.Groups {
-			for _, version := range group.Versions {
-				if version.GroupVersion == "jaegertracing.io/v1" {
-					jaegerStatus1 = "Installed"
-					break
+			for i := range tableData {
+				if k8s.ClusterOf(err.Err) == tableData[i].ClusterName {
+					tableData[i].Errors = append(tableData[i].Errors, err.Err.Error())
 				}
 			}
 		}
-		var jaegerStatus2 string = "Not Installed"
-		for _, group := range apiresources2.Groups {
-			for _, version := range group.Versions {
-				if version.GroupVersion == "jaegertracing.io/v1" {
-					jaegerStatus2 = "Installed"
-					break
-				}
-			}
+		for i := range tableData {
+			tableData[i].Traefik = installedStatus(apiresources[i], "traefik.containo.us/v1alpha1")
+			tableData[i].Flagger = installedStatus(apiresources[i], "flagger.app/v1beta1")
+			tableData[i].Jaeger = installedStatus(apiresources[i], "jaegertracing.io/v1")
 		}
 
-		canaryNum1, ingNum1 := k8s.GetPerCluster(Cluster1, Kubeconfig1)
-		canaryNum2, ingNum2 := k8s.GetPerCluster(Cluster2, Kubeconfig2)
-
-		tableData = append(tableData, tableInfra{
-			ClusterName: Cluster1,
-			KubeVersion: str1,
-			NodeCount:   nodeCount1,
-			NsCount:     nsCount1,
-			CpuTotal:    cpuTotal1,
-			MemTotal:    memTotal1,
-			DiskTotal:   diskTotal1,
-			PodTotal:    podsTotal1,
-			ApiNums:     apiNums1,
-			Traefik:     traefikStatus1,
-			TraefikNum:  ingNum1,
-			Flagger:     canaryStatus1,
-			FlaggerNum:  canaryNum1,
-			Jaeger:      jaegerStatus1,
-		})
-		tableData = append(tableData, tableInfra{
-			ClusterName: Cluster2,
-			KubeVersion: str2,
-			NodeCount:   nodeCount2,
-			NsCount:     nsCount2,
-			CpuTotal:    cpuTotal2,
-			MemTotal:    memTotal2,
-			DiskTotal:   diskTotal2,
-			PodTotal:    podsTotal2,
-			ApiNums:     apiNums2,
-			Traefik:     traefikStatus2,
-			TraefikNum:  ingNum2,
-			Flagger:     canaryStatus2,
-			FlaggerNum:  canaryNum2,
-			Jaeger:      jaegerStatus2,
-		})
 		// Формируем страницу из шаблона для выбора неймспейса
 		err := renderPage(w, "templates/compare_cluster.html", tableData)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-	} else if compar == "Flagger (Canary)" {
-		//var tableData []tableCanary
-		type ClusterNamespaceCanaries struct {
-			ClusterName string
-			Namespace   string
-			Canaries    []string
-		}
-		type Data struct {
-			Clusters  []ClusterNamespaceCanaries
-			Diffs     map[string][]string
-			DiffSpecs map[string][]diff.CanarySpecDiff
-		}
-
-		diff1, diff2 := diff.GetDiff(k8s.GetCanaryPerNs(Cluster1, Kubeconfig1, Namespace1), k8s.GetCanaryPerNs(Cluster2, Kubeconfig2, Namespace2))
-
-		data := Data{
-			Clusters: []ClusterNamespaceCanaries{
-				{
-					ClusterName: Cluster1,
-					Namespace:   Namespace1,
-					Canaries:    k8s.GetCanaryPerNs(Cluster1, Kubeconfig1, Namespace1),
-				},
-				{
-					ClusterName: Cluster2,
-					Namespace:   Namespace2,
-					Canaries:    k8s.GetCanaryPerNs(Cluster2, Kubeconfig2, Namespace2),
-				},
-			},
-			Diffs: map[string][]string{
-				Cluster1: diff1,
-				Cluster2: diff2,
-			},
-			DiffSpecs: map[string][]diff.CanarySpecDiff{
-				"Cluster1": diff.GetDiffCanarySpecs(Cluster1, Kubeconfig1, Cluster2, Kubeconfig2, Namespace1),
-			},
-		}
-
-		// Формируем страницу из шаблона для выбора неймспейса если в указанных НС нет выбранного типа ресурса то выводи пустую страницу
-		isEmpty := true
-		for _, cluster := range data.Clusters {
-			if len(cluster.Canaries) > 0 {
-				isEmpty = false
-				break
-			}
-		}
-		if !isEmpty {
-			err := renderCanaryPage(w, "templates/compare_canary.html", data)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		} else {
-			err := renderPage(w, "templates/blank.html", data)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		}
-	} else if compar == "Deployments" {
-		//var tableData []tableCanary
-		type ClusterNamespaceDeployments struct {
-			ClusterName string
-			Namespace   string
-			Deployments []string
-		}
-		type Data struct {
-			Clusters  []ClusterNamespaceDeployments
-			Diffs     map[string][]string
-			DiffSpecs map[string][]diff.DeploySpecDiff
-		}
-
-		diff1, diff2 := diff.GetDiff(k8s.GetDeployPerNs(Cluster1, Kubeconfig1, Namespace1), k8s.GetDeployPerNs(Cluster2, Kubeconfig2, Namespace2))
-
-		data := Data{
-			Clusters: []ClusterNamespaceDeployments{
-				{
-					ClusterName: Cluster1,
-					Namespace:   Namespace1,
-					Deployments: k8s.GetDeployPerNs(Cluster1, Kubeconfig1, Namespace1),
-				},
-				{
-					ClusterName: Cluster2,
-					Namespace:   Namespace2,
-					Deployments: k8s.GetDeployPerNs(Cluster2, Kubeconfig2, Namespace2),
-				},
-			},
-			Diffs: map[string][]string{
-				Cluster1: diff1,
-				Cluster2: diff2,
-			},
-			DiffSpecs: map[string][]diff.DeploySpecDiff{
-				"Cluster1": diff.GetDiffDeploymentsSpecs(Cluster1, Kubeconfig1, Cluster2, Kubeconfig2, Namespace1),
-			},
-		}
-
-		// Формируем страницу из шаблона для выбора неймспейса если в указанных НС нет выбранного типа ресурса то выводи пустую страницу
-		isEmpty := true
-		for _, cluster := range data.Clusters {
-			if len(cluster.Deployments) > 0 {
-				isEmpty = false
-				break
-			}
-		}
-		if !isEmpty {
-			err := renderCanaryPage(w, "templates/compare_deployments.html", data)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		} else {
-			err := renderPage(w, "templates/blank.html", data)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		}
-
-	} else if compar == "Daemonsets" {
-		//var tableData []tableCanary
-		type ClusterNamespaceDmnsets struct {
-			ClusterName string
-			Namespace   string
-			DmnSets     []string
-		}
-		type Data struct {
-			Clusters  []ClusterNamespaceDmnsets
-			Diffs     map[string][]string
-			DiffSpecs map[string][]diff.DmnSetsSpecDiff
-		}
-
-		diff1, diff2 := diff.GetDiff(k8s.GetUniversalObjectPerNsAsString(Cluster1, Kubeconfig1, Namespace1, "apps", "v1", "daemonsets"), k8s.GetUniversalObjectPerNsAsString(Cluster2, Kubeconfig2, Namespace2, "apps", "v1", "daemonsets"))
-
-		data := Data{
-			Clusters: []ClusterNamespaceDmnsets{
-				{
-					ClusterName: Cluster1,
-					Namespace:   Namespace1,
-					DmnSets:     k8s.GetUniversalObjectPerNsAsString(Cluster1, Kubeconfig1, Namespace1, "apps", "v1", "daemonsets"),
-				},
-				{
-					ClusterName: Cluster2,
-					Namespace:   Namespace2,
-					DmnSets:     k8s.GetUniversalObjectPerNsAsString(Cluster2, Kubeconfig2, Namespace2, "apps", "v1", "daemonsets"),
-				},
-			},
-			Diffs: map[string][]string{
-				Cluster1: diff1,
-				Cluster2: diff2,
-			},
-			DiffSpecs: map[string][]diff.DmnSetsSpecDiff{
-				"Cluster1": diff.GetDiffDmnSetsSpecs(Cluster1, Kubeconfig1, Cluster2, Kubeconfig2, Namespace1),
-			},
-		}
-
-		// Формируем страницу из шаблона для выбора неймспейса если в указанных НС нет выбранного типа ресурса то выводи пустую страницу
-		isEmpty := true
-		for _, cluster := range data.Clusters {
-			if len(cluster.DmnSets) > 0 {
-				isEmpty = false
-				break
-			}
-		}
-		if !isEmpty {
-			err := renderCanaryPage(w, "templates/compare_daemonset.html", data)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		} else {
-			err := renderPage(w, "templates/blank.html", data)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		}
-
-	} else if compar == "Services" {
-
-		type ClusterNamespaceServices struct {
-			ClusterName string
-			Namespace   string
-			Services    []string
-		}
-		type Data struct {
-			Clusters  []ClusterNamespaceServices
-			Diffs     map[string][]string
-			DiffSpecs map[string][]diff.ServicesSpecDiff
-		}
-
-		diff1, diff2 := diff.GetDiff(k8s.GetUniversalObjectPerNsAsString(Cluster1, Kubeconfig1, Namespace1, "", "v1", "services"), k8s.GetUniversalObjectPerNsAsString(Cluster2, Kubeconfig2, Namespace2, "", "v1", "services"))
-
-		data := Data{
-			Clusters: []ClusterNamespaceServices{
-				{
-					ClusterName: Cluster1,
-					Namespace:   Namespace1,
-					Services:    k8s.GetUniversalObjectPerNsAsString(Cluster1, Kubeconfig1, Namespace1, "", "v1", "services"),
-				},
-				{
-					ClusterName: Cluster2,
-					Namespace:   Namespace2,
-					Services:    k8s.GetUniversalObjectPerNsAsString(Cluster2, Kubeconfig2, Namespace2, "", "v1", "services"),
-				},
-			},
-			Diffs: map[string][]string{
-				Cluster1: diff1,
-				Cluster2: diff2,
-			},
-			DiffSpecs: map[string][]diff.ServicesSpecDiff{
-				"Cluster1": diff.GetDiffServicesSpecs(Cluster1, Kubeconfig1, Cluster2, Kubeconfig2, Namespace1),
-			},
-		}
-
-		// Формируем страницу из шаблона для выбора неймспейса если в указанных НС нет выбранного типа ресурса то выводи пустую страницу
-		isEmpty := true
-		for _, cluster := range data.Clusters {
-			if len(cluster.Services) > 0 {
-				isEmpty = false
-				break
-			}
-		}
-		if !isEmpty {
-			err := renderCanaryPage(w, "templates/compare_services.html", data)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		} else {
-			err := renderPage(w, "templates/blank.html", data)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		}
-
-	} else if compar == "HelmValues" {
-
-		helmReleases1, _ := helm.GetHelmReleasesPerNS(Cluster1, Kubeconfig1, Namespace1)
-		helmReleases2, _ := helm.GetHelmReleasesPerNS(Cluster2, Kubeconfig2, Namespace2)
-
-		//var tableData
-		type ClusterNamespaceHelmReleases struct {
-			ClusterName  string
-			Namespace    string
-			HelmReleases []string
-		}
-		type Data struct {
-			Clusters  []ClusterNamespaceHelmReleases
-			Diffs     map[string][]string
-			DiffSpecs map[string][]diff.HelmValuesDiff
-		}
-
-		diff1, diff2 := diff.GetDiff(helmReleases1, helmReleases2)
-
-		data := Data{
-			Clusters: []ClusterNamespaceHelmReleases{
-				{
-					ClusterName:  Cluster1,
-					Namespace:    Namespace1,
-					HelmReleases: helmReleases1,
-				},
-				{
-					ClusterName:  Cluster2,
-					Namespace:    Namespace2,
-					HelmReleases: helmReleases2,
-				},
-			},
-			Diffs: map[string][]string{
-				Cluster1: diff1,
-				Cluster2: diff2,
-			},
-			DiffSpecs: map[string][]diff.HelmValuesDiff{
-				"Cluster1": diff.GetDiffHelmTemplates(Cluster1, Kubeconfig1, Cluster2, Kubeconfig2, Namespace1),
-			},
-		}
-
-		// Формируем страницу из шаблона для выбора неймспейса если в указанных НС нет выбранного типа ресурса то выводи пустую страницу
-		isEmpty := true
-		for _, cluster := range data.Clusters {
-			if len(cluster.HelmReleases) > 0 {
-				isEmpty = false
-				break
-			}
-		}
-		if !isEmpty {
-
-			err := renderCanaryPage(w, "templates/compare_values.html", data)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		} else {
-			err := renderPage(w, "templates/blank.html", data)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		}
-	} else if compar == "IngressRoutes (Traefik)" {
-
-		type ClusterNamespaceTingress struct {
-			ClusterName string
-			Namespace   string
-			TraefikIng  []string
-		}
-		type Data struct {
-			Clusters  []ClusterNamespaceTingress
-			Diffs     map[string][]string
-			DiffSpecs map[string][]diff.TingressSpecDiff
-		}
-
-		diff1, diff2 := diff.GetDiff(k8s.GetUniversalObjectPerNsAsString(Cluster1, Kubeconfig1, Namespace1, "traefik.containo.us", "v1alpha1", "ingressroutes"), k8s.GetUniversalObjectPerNsAsString(Cluster2, Kubeconfig2, Namespace2, "traefik.containo.us", "v1alpha1", "ingressroutes"))
-
-		data := Data{
-			Clusters: []ClusterNamespaceTingress{
-				{
-					ClusterName: Cluster1,
-					Namespace:   Namespace1,
-					TraefikIng:  k8s.GetUniversalObjectPerNsAsString(Cluster1, Kubeconfig1, Namespace1, "traefik.containo.us", "v1alpha1", "ingressroutes"),
-				},
-				{
-					ClusterName: Cluster2,
-					Namespace:   Namespace2,
-					TraefikIng:  k8s.GetUniversalObjectPerNsAsString(Cluster2, Kubeconfig2, Namespace2, "traefik.containo.us", "v1alpha1", "ingressroutes"),
-				},
-			},
-			Diffs: map[string][]string{
-				Cluster1: diff1,
-				Cluster2: diff2,
-			},
-			DiffSpecs: map[string][]diff.TingressSpecDiff{
-				"Cluster1": diff.GetDiffTingressSpecs(Cluster1, Kubeconfig1, Cluster2, Kubeconfig2, Namespace1),
-			},
-		}
-		isEmpty := true
-		for _, cluster := range data.Clusters {
-			if len(cluster.TraefikIng) > 0 {
-				isEmpty = false
-				break
-			}
-		}
-		if !isEmpty {
-			err := renderCanaryPage(w, "templates/compare_tingress.html", data)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		} else {
-			err := renderPage(w, "templates/blank.html", data)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		}
-
+	} else if kind, ok := pickedKind(resource); ok {
+		compareKind(w, r, sel, kind)
 	}
 }
 
-func DisplayCanaryJSONHandler(w http.ResponseWriter, r *http.Request) {
-	canaryObjects1 := k8s.GetCanaryObjectsPerNs(Cluster1, Kubeconfig1, Namespace1)
-	canaryObjects2 := k8s.GetCanaryObjectsPerNs(Cluster2, Kubeconfig2, Namespace2)
-	clusterCanaries := make(map[string]map[string]map[string]interface{})
-
-	for _, canary1 := range canaryObjects1 {
-		// Получаем спецификацию для Canary
-		spec1, found1, err1 := unstructured.NestedFieldNoCopy(canary1.Object, "spec")
-		if err1 != nil || !found1 {
-			// Обрабатываем ошибку или случай, когда спецификация не найдена
-			continue
-		}
-		for _, canary2 := range canaryObjects2 {
-			// Если имена Canary совпадают
-			if canary1.GetName() == canary2.GetName() {
-				spec2, found2, err2 := unstructured.NestedFieldNoCopy(canary2.Object, "spec")
-				if err2 != nil || !found2 {
-					// Обрабатываем ошибку или случай, когда спецификация не найдена
-					continue
-				}
-				clusterCanaries[canary1.GetName()] = map[string]map[string]interface{}{
-					Cluster1: spec1.(map[string]interface{}),
-					Cluster2: spec2.(map[string]interface{}),
-				}
+// installedStatus checks if the api group version is served by the cluster
+func installedStatus(groups *metav1.APIGroupList, groupVersion string) string {
+	if groups == nil {
+		return "Unknown"
+	}
+	for _, group := range groups.Groups {
+		for _, version := range group.Versions {
+			if version.GroupVersion == groupVersion {
+				return "Installed"
 			}
 		}
 	}
+	return "Not Installed"
+}
 
-	// Загрузить шаблон страницы
-	tmpl, err := template.New("canary_json.html").Funcs(template.FuncMap{
-		"toJSON": func(v interface{}) string {
-			a, _ := json.MarshalIndent(v, "", "    ")
-			return string(a)
-		},
-	}).ParseFiles("templates/canary_json.html")
-
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	// Выполнить шаблон с данными canaryJSON
-	err = tmpl.Execute(w, clusterCanaries)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+// errorMessages returns messages of the fetch plan errors shown on the page
+func errorMessages(errs []k8s.CallError) []string {
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Err.Error())
 	}
+	return messages
 }
 
-func DisplayDeployJSONHandler(w http.ResponseWriter, r *http.Request) {
-	group := "apps"
-	version := "v1"
-	resource := "deployments"
-	deployObjects1 := k8s.GetUniversalObjectsPerNsUnstruct(Cluster1, Kubeconfig1, Namespace1, group, version, resource)
-	deployObjects2 := k8s.GetUniversalObjectsPerNsUnstruct(Cluster2, Kubeconfig2, Namespace2, group, version, resource)
-	clusterDeployments := make(map[string]map[string]map[string]interface{})
-
-	for _, deploy1 := range deployObjects1 {
-		// Получаем спецификацию для Deployment
-		spec1, found1, err1 := unstructured.NestedFieldNoCopy(deploy1.Object, "spec")
-		if err1 != nil || !found1 {
-			// Обрабатываем ошибку или случай, когда спецификация не найдена
-			continue
-		}
-		for _, deploy2 := range deployObjects2 {
-			if deploy1.GetName() == deploy2.GetName() {
-				spec2, found2, err2 := unstructured.NestedFieldNoCopy(deploy2.Object, "spec")
-				if err2 != nil || !found2 {
-					// Обрабатываем ошибку или случай, когда спецификация не найдена
-					continue
-				}
-				clusterDeployments[deploy1.GetName()] = map[string]map[string]interface{}{
-					Cluster1: spec1.(map[string]interface{}),
-					Cluster2: spec2.(map[string]interface{}),
-				}
-			}
-		}
+// logCallErrors logs errors of the fetch plan, it returns true when the request
+// is cancelled (browser tab is closed) and there is no one to render the page for
+func logCallErrors(r *http.Request, errs []k8s.CallError) bool {
+	for _, err := range errs {
+		log.Println("Failed API call:", err)
 	}
+	return r.Context().Err() != nil
+}
 
-	// Загрузить шаблон страницы
-	tmpl, err := template.New("deployments_json.html").Funcs(template.FuncMap{
-		"toJSON": func(v interface{}) string {
-			a, _ := json.MarshalIndent(v, "", "    ")
-			return string(a)
-		},
-	}).ParseFiles("templates/deployments_json.html")
-
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+// CompareKindHandler shows report for the kind from url, used for related kinds
+// which are not in the resource picker (canary -> metrictemplates)
+func CompareKindHandler(w http.ResponseWriter, r *http.Request, s *state.Session) {
+	kind, ok := diff.KindByID(mux.Vars(r)["kind"])
+	if !ok {
+		http.NotFound(w, r)
 		return
 	}
+	compareKind(w, r, s.Selection(), kind)
+}
 
-	// Выполнить шаблон с данными deployJSON
-	err = tmpl.Execute(w, clusterDeployments)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+type clusterObjects struct {
+	ClusterName string
+	Namespace   string
+	Objects     []string
+	Status      diff.Status
 }
 
-func DisplayDmnSetJSONHandler(w http.ResponseWriter, r *http.Request) {
-	dmnSetObjects1 := k8s.GetUniversalObjectsPerNsUnstruct(Cluster1, Kubeconfig1, Namespace1, "apps", "v1", "daemonsets")
-	dmnSetObjects2 := k8s.GetUniversalObjectsPerNsUnstruct(Cluster2, Kubeconfig2, Namespace2, "apps", "v1", "daemonsets")
-	clusterDmnsets := make(map[string]map[string]map[string]interface{})
+type compareData struct {
+	Kind      diff.Kind
+	Cluster1  string
+	Cluster2  string
+	Clusters  []clusterObjects
+	Diffs     map[string][]string
+	DiffSpecs []diff.ResourceDiff
+	// Statuses are sides which could not be read, their objects are not compared
+	Statuses []diff.Status
+	// Releases are differences of rendered manifests of helm releases (HelmValues report)
+	Releases []diff.ReleaseManifests
+}
 
-	for _, dmnset1 := range dmnSetObjects1 {
-		// Получаем спецификацию для Deployment
-		spec1, found1, err1 := unstructured.NestedFieldNoCopy(dmnset1.Object, "spec")
-		if err1 != nil || !found1 {
-			// Обрабатываем ошибку или случай, когда спецификация не найдена
+func compareKind(w http.ResponseWriter, r *http.Request, sel state.Selection, kind diff.Kind) {
+	result, err := diff.Compare(r.Context(), kind, sel.SidePairs())
+	if err != nil {
+		return // request is cancelled
+	}
+	data := compareData{
+		Kind:      kind,
+		Cluster1:  sel.Cluster1,
+		Cluster2:  sel.Cluster2,
+		Diffs:     make(map[string][]string),
+		DiffSpecs: []diff.ResourceDiff{},
+	}
+	for _, pair := range result.Pairs {
+		side1, side2 := pair.Side1, pair.Side2
+		row1, row2 := pairRows(pair)
+		data.Clusters = append(data.Clusters, row1, row2)
+		if len(pair.Statuses) > 0 {
+			data.Statuses = append(data.Statuses, pair.Statuses...)
 			continue
 		}
-		for _, dmnset2 := range dmnSetObjects2 {
-			if dmnset1.GetName() == dmnset2.GetName() {
-				spec2, found2, err2 := unstructured.NestedFieldNoCopy(dmnset2.Object, "spec")
-				if err2 != nil || !found2 {
-					// Обрабатываем ошибку или случай, когда спецификация не найдена
-					continue
-				}
-				clusterDmnsets[dmnset1.GetName()] = map[string]map[string]interface{}{
-					Cluster1: spec1.(map[string]interface{}),
-					Cluster2: spec2.(map[string]interface{}),
-				}
-			}
-		}
-	}
-
-	// Загрузить шаблон страницы
-	tmpl, err := template.New("dmnsets_json.html").Funcs(template.FuncMap{
-		"toJSON": func(v interface{}) string {
-			a, _ := json.MarshalIndent(v, "", "    ")
-			return string(a)
-		},
-	}).ParseFiles("templates/dmnsets_json.html")
-
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	// Выполнить шаблон с данными deployJSON
-	err = tmpl.Execute(w, clusterDmnsets)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		data.Diffs[side1.Cluster+"/"+side1.Namespace] = pair.Only1
+		data.Diffs[side2.Cluster+"/"+side2.Namespace] = pair.Only2
+		data.DiffSpecs = append(data.DiffSpecs, pair.Diffs...)
 	}
-}
 
-func DisplaySvsJSONHandler(w http.ResponseWriter, r *http.Request) {
-	svcObjects1 := k8s.GetUniversalObjectsPerNsUnstruct(Cluster1, Kubeconfig1, Namespace1, "", "v1", "services")
-	svcObjects2 := k8s.GetUniversalObjectsPerNsUnstruct(Cluster2, Kubeconfig2, Namespace2, "", "v1", "services")
-	clusterSvcs := make(map[string]map[string]map[string]interface{})
-
-	for _, svcs1 := range svcObjects1 {
-		// Получаем спецификацию для Deployment
-		spec1, found1, err1 := unstructured.NestedFieldNoCopy(svcs1.Object, "spec")
-		if err1 != nil || !found1 {
-			// Обрабатываем ошибку или случай, когда спецификация не найдена
-			continue
+	// values can be equal while charts render different objects, so manifests
+	// of the releases are shown under their values
+	if kind.ID == "helmvalues" || kind.RulesOf == "helmvalues" {
+		releases, statuses, err := diff.CompareReleaseManifests(r.Context(), kind.SidePairs(sel.SidePairs()))
+		if err != nil {
+			return // request is cancelled
 		}
-		for _, svcs2 := range svcObjects2 {
-			if svcs1.GetName() == svcs2.GetName() {
-				spec2, found2, err2 := unstructured.NestedFieldNoCopy(svcs2.Object, "spec")
-				if err2 != nil || !found2 {
-					// Обрабатываем ошибку или случай, когда спецификация не найдена
-					continue
-				}
-				clusterSvcs[svcs1.GetName()] = map[string]map[string]interface{}{
-					Cluster1: spec1.(map[string]interface{}),
-					Cluster2: spec2.(map[string]interface{}),
-				}
+		data.Releases = releases
+		for _, status := range statuses {
+			if !hasFailedSide(data.Statuses, status) {
+				data.Statuses = append(data.Statuses, status)
 			}
 		}
 	}
 
-	// Загрузить шаблон страницы
-	tmpl, err := template.New("services_json.html").Funcs(template.FuncMap{
-		"toJSON": func(v interface{}) string {
-			a, _ := json.MarshalIndent(v, "", "    ")
-			return string(a)
-		},
-	}).ParseFiles("templates/services_json.html")
-
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	// если в указанных НС нет выбранного типа ресурса то выводим пустую страницу
+	if result.Empty() {
+		err := renderPage(w, "templates/blank.html", data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
 		return
 	}
 
-	// Выполнить шаблон с данными deployJSON
-	err = tmpl.Execute(w, clusterSvcs)
+	page := kind.Template
+	if page == "" {
+		page = "templates/compare_resources.html"
+	}
+	err = renderCanaryPage(w, page, data)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 }
 
-func DisplayHelmJSONHandler(w http.ResponseWriter, r *http.Request) {
-	helmSpec1, _ := helm.GetHelmReleasesJsonPerNS(Cluster1, Kubeconfig1, Namespace1)
-	helmSpec2, _ := helm.GetHelmReleasesJsonPerNS(Cluster2, Kubeconfig2, Namespace2)
-	clusterReleases := make(map[string]map[string]map[string]interface{})
-
-	for _, values1 := range helmSpec1 {
-		// Получаем спецификацию для Deployment
-		spec1, found1, err1 := unstructured.NestedFieldNoCopy(values1.Object)
-		if err1 != nil || !found1 {
-			// Обрабатываем ошибку или случай, когда спецификация не найдена
-			continue
-		}
-		for _, values2 := range helmSpec2 {
-			if values1.Object["releaseName"] == values2.Object["releaseName"] {
-				spec2, found2, err2 := unstructured.NestedFieldNoCopy(values2.Object)
-				if err2 != nil || !found2 {
-					// Обрабатываем ошибку или случай, когда спецификация не найдена
-					continue
-				}
-				name := values1.Object["releaseName"].(string)
-				clusterReleases[name] = map[string]map[string]interface{}{
-					Cluster1: spec1.(map[string]interface{}),
-					Cluster2: spec2.(map[string]interface{}),
-				}
-			}
-		}
+// pairRows returns rows of both sides of the pair, statuses are matched to the
+// rows by their index, not by the side (a namespace can be compared with itself)
+func pairRows(pair diff.PairResult) (clusterObjects, clusterObjects) {
+	rows := [2]clusterObjects{
+		{ClusterName: pair.Side1.Cluster, Namespace: pair.Side1.Namespace, Objects: pair.Objects1},
+		{ClusterName: pair.Side2.Cluster, Namespace: pair.Side2.Namespace, Objects: pair.Objects2},
 	}
-
-	// Загрузить шаблон страницы
-	tmpl, err := template.New("helm_json.html").Funcs(template.FuncMap{
-		"toJSON": func(v interface{}) string {
-			a, _ := json.MarshalIndent(v, "", "    ")
-			return string(a)
-		},
-	}).ParseFiles("templates/helm_json.html")
-
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	for _, status := range pair.Statuses {
+		if status.Index == 0 || status.Index == 1 {
+			rows[status.Index].Status = status
+		}
 	}
+	return rows[0], rows[1]
+}
 
-	// Выполнить шаблон с данными deployJSON
-	err = tmpl.Execute(w, clusterReleases)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+// hasFailedSide is true when values of the side could not be read already, the
+// same error is not shown twice
+func hasFailedSide(statuses []diff.Status, failed diff.Status) bool {
+	for _, status := range statuses {
+		if status.Side == failed.Side && status.Index == failed.Index {
+			return true
+		}
 	}
+	return false
 }
 
-func CompareClusterCMTHandler(w http.ResponseWriter, r *http.Request) {
-	type ClusterNamespaceMT struct {
-		ClusterName string
-		Namespace   string
-		MetricTpl   []string
-	}
-	type Data struct {
-		Clusters  []ClusterNamespaceMT
-		Diffs     map[string][]string
-		DiffSpecs map[string][]diff.MTSpecDiff
-	}
-	diff1, diff2 := diff.GetDiff(k8s.GetMTPerNs(Cluster1, Kubeconfig1, Namespace1), k8s.GetMTPerNs(Cluster2, Kubeconfig2, Namespace2))
-	data := Data{
-		Clusters: []ClusterNamespaceMT{
-			{
-				ClusterName: Cluster1,
-				Namespace:   Namespace1,
-				MetricTpl:   k8s.GetMTPerNs(Cluster1, Kubeconfig1, Namespace1),
-			},
-			{
-				ClusterName: Cluster2,
-				Namespace:   Namespace2,
-				MetricTpl:   k8s.GetMTPerNs(Cluster2, Kubeconfig2, Namespace2),
-			},
-		},
-		Diffs: map[string][]string{
-			Cluster1: diff1,
-			Cluster2: diff2,
-		},
-		DiffSpecs: map[string][]diff.MTSpecDiff{
-			"Cluster1": diff.GetDiffMetricTemplatesSpecs(Cluster1, Kubeconfig1, Cluster2, Kubeconfig2, Namespace1),
-		},
+// DisplayJSONHandler shows full specs of objects present in both clusters, sorted by names
+func DisplayJSONHandler(w http.ResponseWriter, r *http.Request, s *state.Session) {
+	kind, ok := diff.KindByID(mux.Vars(r)["kind"])
+	if !ok {
+		http.NotFound(w, r)
+		return
 	}
-
-	err := renderCanaryPage(w, "templates/canary_mt.html", data)
+	sides := kind.SidePairs(s.Selection().SidePairs())
+	listed, err := diff.ListPairs(r.Context(), kind, sides)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return // request is cancelled
 	}
-}
-
-func DisplayTingJSONHandler(w http.ResponseWriter, r *http.Request) {
-	ingObjects1 := k8s.GetUniversalObjectsPerNsUnstruct(Cluster1, Kubeconfig1, Namespace1, "traefik.containo.us", "v1alpha1", "ingressroutes")
-	ingObjects2 := k8s.GetUniversalObjectsPerNsUnstruct(Cluster2, Kubeconfig2, Namespace2, "traefik.containo.us", "v1alpha1", "ingressroutes")
-	clusterIngs := make(map[string]map[string]map[string]interface{})
-
-	for _, item1 := range ingObjects1 {
-		spec1, found1, err1 := unstructured.NestedFieldNoCopy(item1.Object, "spec")
-		if err1 != nil || !found1 {
-			// Обрабатываем ошибку или случай, когда спецификация не найдена
-			continue
+	objects := make(map[string]map[string]interface{})
+	var statuses []diff.Status
+	for i, pair := range sides {
+		for _, read := range listed[i] {
+			if read.Status.Failed() {
+				statuses = append(statuses, read.Status)
+			}
 		}
-		for _, item2 := range ingObjects2 {
-			if item1.GetName() == item2.GetName() {
-				spec2, found2, err2 := unstructured.NestedFieldNoCopy(item2.Object, "spec")
-				if err2 != nil || !found2 {
-					// Обрабатываем ошибку или случай, когда спецификация не найдена
-					continue
-				}
-				clusterIngs[item1.GetName()] = map[string]map[string]interface{}{
-					Cluster1: spec1.(map[string]interface{}),
-					Cluster2: spec2.(map[string]interface{}),
-				}
+		for name, specs := range diff.PairSpecs(kind, pair[0], listed[i][0].Objects, pair[1], listed[i][1].Objects) {
+			if len(sides) > 1 {
+				name = pair[0].Namespace + "/" + name
 			}
+			objects[name] = specs
 		}
 	}
 
+	data := struct {
+		Kind     diff.Kind
+		Objects  map[string]map[string]interface{}
+		Statuses []diff.Status
+	}{
+		Kind:     kind,
+		Objects:  objects,
+		Statuses: statuses,
+	}
+
 	// Загрузить шаблон страницы
-	tmpl, err := template.New("tingress_json.html").Funcs(template.FuncMap{
+	tmpl, err := template.New("resources_json.html").Funcs(template.FuncMap{
 		"toJSON": func(v interface{}) string {
 			a, _ := json.MarshalIndent(v, "", "    ")
 			return string(a)
 		},
-	}).ParseFiles("templates/tingress_json.html")
+	}).ParseFiles("templates/resources_json.html")
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Выполнить шаблон с данными deployJSON
-	err = tmpl.Execute(w, clusterIngs)
+	err = tmpl.Execute(w, data)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"compareapp/diff"
+	"errors"
+	"testing"
+)
+
+func TestPairRows(t *testing.T) {
+	side := diff.Side{Cluster: "stage", Namespace: "foo"}
+	other := diff.Side{Cluster: "prod", Namespace: "foo"}
+	failed := func(side diff.Side, index int, message string) diff.Status {
+		return diff.Status{Kind: "Deployments", Side: side, Index: index, Err: errors.New(message)}
+	}
+	tests := []struct {
+		name         string
+		pair         diff.PairResult
+		want1, want2 string // errors of the rows, empty when the row is read
+	}{
+		{
+			name:  "second side failed",
+			pair:  diff.PairResult{Side1: side, Side2: other, Statuses: []diff.Status{failed(other, 1, "forbidden")}},
+			want2: "forbidden",
+		},
+		{
+			name:  "first side failed",
+			pair:  diff.PairResult{Side1: side, Side2: other, Statuses: []diff.Status{failed(side, 0, "timeout")}},
+			want1: "timeout",
+		},
+		{
+			name:  "namespace compared with itself, second side failed",
+			pair:  diff.PairResult{Side1: side, Side2: side, Statuses: []diff.Status{failed(side, 1, "forbidden")}},
+			want2: "forbidden",
+		},
+		{
+			name:  "namespace compared with itself, both failed",
+			pair:  diff.PairResult{Side1: side, Side2: side, Statuses: []diff.Status{failed(side, 1, "timeout"), failed(side, 0, "forbidden")}},
+			want1: "forbidden",
+			want2: "timeout",
+		},
+	}
+	for _, tt := range tests {
+		row1, row2 := pairRows(tt.pair)
+		for i, check := range []struct {
+			row  clusterObjects
+			want string
+		}{{row1, tt.want1}, {row2, tt.want2}} {
+			got := ""
+			if check.row.Status.Failed() {
+				got = check.row.Status.Err.Error()
+			}
+			if got != check.want {
+				t.Errorf("%s: row %d error = %q, want %q", tt.name, i+1, got, check.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"compareapp/diff"
+	"compareapp/helm"
+	"compareapp/k8s"
+	"compareapp/state"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+type releaseHistory struct {
+	Index     int // 1 or 2, used in links to the revision diff
+	Side      diff.Side
+	Revisions []historyRow
+	Current   int // deployed revision, 0 when the release is not deployed
+	Error     string
+}
+
+type historyRow struct {
+	Entry    helm.Revision
+	Previous int // previous revision kept by helm, 0 for the oldest one
+}
+
+type historyData struct {
+	Release    string
+	Namespace1 string
+	Namespace2 string
+	Sides      []releaseHistory
+}
+
+// releaseSides returns sides of the release in both clusters, namespaces are
+// taken from the query or from the first selected namespace pair. Empty namespace
+// in the query (reports of all namespaces) means the release is looked up by name.
+func releaseSides(r *http.Request, s *state.Session) (diff.Side, diff.Side) {
+	sel := s.Selection()
+	pair := diff.NamespacePair{Namespace1: sel.Namespace1, Namespace2: sel.Namespace2}
+	query := r.URL.Query()
+	if _, ok := query["ns1"]; ok {
+		pair.Namespace1 = query.Get("ns1")
+	}
+	if _, ok := query["ns2"]; ok {
+		pair.Namespace2 = query.Get("ns2")
+	}
+	return sel.Sides(pair)
+}
+
+// HelmHistoryHandler shows revisions of the release in both clusters and which revision is deployed
+func HelmHistoryHandler(w http.ResponseWriter, r *http.Request, s *state.Session) {
+	release := mux.Vars(r)["release"]
+	side1, side2 := releaseSides(r, s)
+	data := historyData{
+		Release:    release,
+		Namespace1: side1.Namespace,
+		Namespace2: side2.Namespace,
+		Sides:      []releaseHistory{{Index: 1, Side: side1}, {Index: 2, Side: side2}},
+	}
+
+	plan := k8s.NewPlan(r.Context())
+	for i := range data.Sides {
+		h := &data.Sides[i]
+		plan.Go("helm history of "+release+" in "+h.Side.Cluster, func(ctx context.Context) (err error) {
+			revisions, err := helm.GetReleaseHistory(ctx, h.Side.Cluster, h.Side.Kubeconfig, h.Side.Namespace, release)
+			if err != nil {
+				h.Error = err.Error()
+				return err
+			}
+			// revisions are newest first
+			for j, revision := range revisions {
+				row := historyRow{Entry: revision}
+				if j+1 < len(revisions) {
+					row.Previous = revisions[j+1].Revision
+				}
+				if revision.Status == "deployed" && revision.Revision > h.Current {
+					h.Current = revision.Revision
+				}
+				h.Revisions = append(h.Revisions, row)
+			}
+			return nil
+		})
+	}
+	if logCallErrors(r, plan.Wait()) {
+		return
+	}
+
+	if err := renderPage(w, "templates/helm_history.html", data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// parseRevisionRef parses "1:5" (revision 5 in the first cluster), revision 0 is the current one
+func parseRevisionRef(ref string) (int, int, error) {
+	side, revision, ok := strings.Cut(ref, ":")
+	if !ok {
+		revision = "0"
+	}
+	index, err := strconv.Atoi(side)
+	if err != nil || (index != 1 && index != 2) {
+		return 0, 0, fmt.Errorf("invalid revision %q, expected <1|2>:<revision>", ref)
+	}
+	number, err := strconv.Atoi(revision)
+	if err != nil || number < 0 {
+		return 0, 0, fmt.Errorf("invalid revision %q, expected <1|2>:<revision>", ref)
+	}
+	return index, number, nil
+}
+
+// HelmRevisionDiffHandler compares values and manifests of two revisions of the
+// release, ?from=1:4&to=1:5 compares revisions of the first cluster, ?from=1:0&to=2:0
+// compares current revisions of both clusters
+func HelmRevisionDiffHandler(w http.ResponseWriter, r *http.Request, s *state.Session) {
+	release := mux.Vars(r)["release"]
+	side1, side2 := releaseSides(r, s)
+	sides := map[int]diff.Side{1: side1, 2: side2}
+
+	var refs [2]struct {
+		side     diff.Side
+		revision int
+		rendered *helm.Rendered
+	}
+	for i, param := range []string{"from", "to"} {
+		index, revision, err := parseRevisionRef(r.FormValue(param))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		refs[i].side, refs[i].revision = sides[index], revision
+	}
+
+	plan := k8s.NewPlan(r.Context())
+	for i := range refs {
+		ref := &refs[i]
+		plan.Go("helm release "+release+" in "+ref.side.Cluster, func(ctx context.Context) (err error) {
+			ref.rendered, err = helm.GetRelease(ctx, ref.side.Cluster, ref.side.Kubeconfig, ref.side.Namespace, release, ref.revision)
+			return err
+		})
+	}
+	errs := plan.Wait()
+	if logCallErrors(r, errs) {
+		return
+	}
+	if len(errs) > 0 {
+		http.Error(w, strings.Join(errorMessages(errs), "\n"), http.StatusBadGateway)
+		return
+	}
+
+	data := struct {
+		diff.RevisionDiff
+		Namespace1 string
+		Namespace2 string
+	}{
+		RevisionDiff: diff.CompareRevisions(refs[0].side, refs[0].rendered, refs[1].side, refs[1].rendered),
+		Namespace1:   side1.Namespace,
+		Namespace2:   side2.Namespace,
+	}
+	if err := renderCanaryPage(w, "templates/helm_revisions.html", data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"compareapp/diff"
+	"compareapp/state"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type matrixData struct {
+	diff.MatrixResult
+	Clusters []string
+}
+
+// CompareMatrixHandler compares the kind in all selected clusters at once, one
+// column per cluster. The kind is the url id or the resource picked on the resources page.
+func CompareMatrixHandler(w http.ResponseWriter, r *http.Request, s *state.Session) {
+	kind, ok := diff.KindByID(mux.Vars(r)["kind"])
+	if !ok {
+		kind, ok = pickedKind(r.FormValue("resource"))
+	}
+	if !ok {
+		http.Error(w, fmt.Sprintf("Resource %q can't be compared in the matrix", r.FormValue("resource")), http.StatusBadRequest)
+		return
+	}
+
+	sel := s.Selection()
+	result, err := diff.CompareMatrix(r.Context(), kind, sel.MatrixGroups())
+	if err != nil {
+		return // request is cancelled
+	}
+	data := matrixData{MatrixResult: result, Clusters: sel.Clusters()}
+	if err := renderCanaryPage(w, "templates/compare_matrix.html", data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
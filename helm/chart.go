@@ -0,0 +1,188 @@
+package helm
+
+import (
+	"compareapp/k8s"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/cli/values"
+	"helm.sh/helm/v3/pkg/getter"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/klog/v2"
+)
+
+// Rendered is a release rendered from a chart: its manifests and all values
+// (chart defaults merged with user supplied values)
+type Rendered struct {
+	Name      string
+	Namespace string
+	Chart     string // chart name-version
+	Revision  int    // revision of the deployed release, 0 for locally rendered chart
+	Objects   []unstructured.Unstructured
+	Values    map[string]interface{}
+}
+
+// RenderChart renders local chart directory or .tgz like `helm upgrade --dry-run`
+// without changing the cluster. caps are .Capabilities of the target cluster (see
+// ClusterCapabilities), so charts checking api versions render the same objects
+// as in the cluster; nil caps are the defaults of `helm template`.
+func RenderChart(chartPath string, valueOpts *values.Options, releaseName, namespace string, caps *chartutil.Capabilities) (*Rendered, error) {
+	chrt, err := loader.Load(chartPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chart %s: %v", chartPath, err)
+	}
+	vals, err := valueOpts.MergeValues(getter.All(cli.New()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read values: %v", err)
+	}
+
+	install := action.NewInstall(renderConfig(caps))
+	install.DryRun = true
+	// client only mode always adds api versions known to helm, so with the cluster
+	// capabilities the chart is rendered against a client which changes nothing
+	install.ClientOnly = caps == nil
+	install.IsUpgrade = true // render .Release.IsUpgrade the same as upgrade of the release does
+	install.Replace = true
+	install.ReleaseName = releaseName
+	install.Namespace = namespace
+	rel, err := install.Run(chrt, vals)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render chart %s: %v", chartPath, err)
+	}
+	return newRendered(rel.Name, rel.Namespace, rel.Chart, 0, rel.Manifest, rel.Config)
+}
+
+// renderConfig returns helm configuration which renders charts without cluster
+func renderConfig(caps *chartutil.Capabilities) *action.Configuration {
+	if caps == nil {
+		return &action.Configuration{Log: klog.Infof}
+	}
+	return &action.Configuration{
+		Capabilities: caps,
+		KubeClient:   &kubefake.PrintingKubeClient{Out: io.Discard},
+		Releases:     storage.Init(driver.NewMemory()),
+		Log:          klog.Infof,
+	}
+}
+
+// ClusterCapabilities returns kubernetes version and api versions served by the
+// cluster, the same .Capabilities as `helm upgrade` of the release gets
+func ClusterCapabilities(ctx context.Context, cluster, kubeconfig string) (*chartutil.Capabilities, error) {
+	if k8s.IsOffline(kubeconfig) {
+		return nil, k8s.Classify(cluster, "capabilities", k8s.OfflineUnsupported(kubeconfig, "capabilities"))
+	}
+	clients, err := k8s.GetClients(cluster, kubeconfig)
+	if err != nil {
+		return nil, k8s.Classify(cluster, "capabilities", err)
+	}
+	client, err := clients.DiscoveryWithContext(ctx)
+	if err != nil {
+		return nil, k8s.Classify(cluster, "capabilities", err)
+	}
+	version, err := client.ServerVersion()
+	if err != nil {
+		return nil, k8s.Classify(cluster, "capabilities", err)
+	}
+	apiVersions, err := action.GetVersionSet(client)
+	if err != nil {
+		return nil, k8s.Classify(cluster, "capabilities", err)
+	}
+	return &chartutil.Capabilities{
+		KubeVersion: chartutil.KubeVersion{
+			Version: version.GitVersion,
+			Major:   version.Major,
+			Minor:   version.Minor,
+		},
+		APIVersions: apiVersions,
+		HelmVersion: chartutil.DefaultCapabilities.HelmVersion,
+	}, nil
+}
+
+// GetRelease returns manifests and all values of the release revision, the
+// current revision for revision 0
+func GetRelease(ctx context.Context, cluster, kubeconfig, namespace, releaseName string, revision int) (*Rendered, error) {
+	if k8s.IsOffline(kubeconfig) {
+		return nil, k8s.Classify(cluster, "helm release", k8s.OfflineUnsupported(kubeconfig, "helm releases"))
+	}
+	if namespace == "" {
+		var err error
+		if namespace, err = releaseNamespace(cluster, kubeconfig, releaseName); err != nil {
+			return nil, k8s.Classify(cluster, "helm release", err)
+		}
+	}
+	actionConfig, err := k8s.HelmConfig(cluster, kubeconfig, namespace)
+	if err != nil {
+		return nil, k8s.Classify(cluster, "helm release", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, k8s.Classify(cluster, "helm release", err)
+	}
+	getClient := action.NewGet(actionConfig)
+	getClient.Version = revision
+	rel, err := getClient.Run(releaseName)
+	if err != nil {
+		return nil, k8s.Classify(cluster, "helm release", err)
+	}
+	return newRendered(rel.Name, rel.Namespace, rel.Chart, rel.Version, rel.Manifest, rel.Config)
+}
+
+func newRendered(name, namespace string, chrt *chart.Chart, revision int, manifest string, config map[string]interface{}) (*Rendered, error) {
+	objects, err := k8s.ParseManifests([]byte(manifest))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse manifests of release %s: %v", name, err)
+	}
+	allValues := config
+	var chartName string
+	if chrt != nil {
+		// releases stored by old or broken clients can have no chart metadata,
+		// helm needs it for merging the values
+		if chrt.Metadata != nil {
+			chartName = chrt.Metadata.Name + "-" + chrt.Metadata.Version
+		} else {
+			withMetadata := *chrt
+			withMetadata.Metadata = &chart.Metadata{}
+			chrt = &withMetadata
+		}
+		if allValues, err = coalescedValues(chrt, config); err != nil {
+			return nil, err
+		}
+	}
+	return &Rendered{
+		Name:      name,
+		Namespace: namespace,
+		Chart:     chartName,
+		Revision:  revision,
+		Objects:   objects,
+		Values:    allValues,
+	}, nil
+}
+
+// coalescedValues returns chart defaults merged with user supplied values, the
+// same as `helm get values --all`
+func coalescedValues(chrt *chart.Chart, config map[string]interface{}) (map[string]interface{}, error) {
+	allValues, err := chartutil.CoalesceValues(chrt, config)
+	if err != nil {
+		return nil, err
+	}
+	// stored release values are decoded from JSON and --set values are int64,
+	// JSON round trip makes numbers of both sides float64
+	data, err := json.Marshal(allValues)
+	if err != nil {
+		return nil, err
+	}
+	normalized := map[string]interface{}{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
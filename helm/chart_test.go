@@ -0,0 +1,122 @@
+package helm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/cli/values"
+)
+
+const pdbTemplate = `{{- if .Capabilities.APIVersions.Has "policy/v1/PodDisruptionBudget" }}
+apiVersion: policy/v1
+{{- else }}
+apiVersion: policy/v1beta1
+{{- end }}
+kind: PodDisruptionBudget
+metadata:
+  name: {{ .Release.Name }}
+  annotations:
+    kubeVersion: {{ .Capabilities.KubeVersion.Version | quote }}
+spec:
+  minAvailable: {{ .Values.minAvailable }}
+`
+
+func writeChart(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"Chart.yaml":             "apiVersion: v2\nname: app\nversion: 1.0.0\n",
+		"values.yaml":            "minAvailable: 1\n",
+		"templates/pdb.yaml":     pdbTemplate,
+		"templates/_helpers.tpl": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestRenderChartCapabilities(t *testing.T) {
+	chartPath := writeChart(t)
+	tests := []struct {
+		name            string
+		caps            *chartutil.Capabilities
+		wantAPIVersion  string
+		wantKubeVersion string
+	}{
+		{
+			name: "cluster without policy/v1",
+			caps: &chartutil.Capabilities{
+				KubeVersion: chartutil.KubeVersion{Version: "v1.20.15", Major: "1", Minor: "20"},
+				APIVersions: chartutil.VersionSet{"v1", "policy/v1beta1", "policy/v1beta1/PodDisruptionBudget"},
+			},
+			wantAPIVersion:  "policy/v1beta1",
+			wantKubeVersion: "v1.20.15",
+		},
+		{
+			name: "cluster with policy/v1",
+			caps: &chartutil.Capabilities{
+				KubeVersion: chartutil.KubeVersion{Version: "v1.27.3", Major: "1", Minor: "27"},
+				APIVersions: chartutil.VersionSet{"v1", "policy/v1", "policy/v1/PodDisruptionBudget"},
+			},
+			wantAPIVersion:  "policy/v1",
+			wantKubeVersion: "v1.27.3",
+		},
+		{
+			name:            "defaults of helm template",
+			wantAPIVersion:  "policy/v1beta1",
+			wantKubeVersion: chartutil.DefaultCapabilities.KubeVersion.Version,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rendered, err := RenderChart(chartPath, &values.Options{Values: []string{"minAvailable=2"}}, "app", "payments", tt.caps)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rendered.Objects) != 1 {
+				t.Fatalf("got %d objects, want 1", len(rendered.Objects))
+			}
+			obj := rendered.Objects[0]
+			if obj.GetAPIVersion() != tt.wantAPIVersion {
+				t.Errorf("apiVersion = %s, want %s", obj.GetAPIVersion(), tt.wantAPIVersion)
+			}
+			if got := obj.GetAnnotations()["kubeVersion"]; got != tt.wantKubeVersion {
+				t.Errorf("kubeVersion = %s, want %s", got, tt.wantKubeVersion)
+			}
+			if rendered.Chart != "app-1.0.0" || rendered.Values["minAvailable"] != float64(2) {
+				t.Errorf("chart = %s, values = %v", rendered.Chart, rendered.Values)
+			}
+		})
+	}
+}
+
+func TestNewRenderedWithoutChartMetadata(t *testing.T) {
+	config := map[string]interface{}{"replicas": float64(2)}
+	tests := []struct {
+		chrt      *chart.Chart
+		wantImage interface{}
+	}{
+		{nil, nil},
+		{&chart.Chart{}, nil},
+		{&chart.Chart{Values: map[string]interface{}{"image": "app:1", "replicas": 1}}, "app:1"},
+	}
+	for _, tt := range tests {
+		rendered, err := newRendered("app", "payments", tt.chrt, 3, "", config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rendered.Chart != "" || rendered.Values["replicas"] != float64(2) || rendered.Values["image"] != tt.wantImage {
+			t.Errorf("newRendered(%v) = %+v", tt.chrt, rendered)
+		}
+	}
+}
@@ -1,43 +1,70 @@
 package helm
 
 import (
-	"fmt"
-	"os"
+	"compareapp/k8s"
+	"context"
+	"log"
+	"time"
 
 	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/cli-runtime/pkg/genericclioptions"
-	"k8s.io/klog/v2"
 )
 
-func GetHelmReleasesPerNS(cluster, kubeconfig string, namespace string) ([]string, error) {
-	var releases []string
-
-	// Create a new config flags object
-	configFlags := genericclioptions.NewConfigFlags(true)
-	// Set the kubeconfig path
-	configFlags.KubeConfig = &kubeconfig
-
-	// Create the Helm client configuration
-	actionConfig := new(action.Configuration)
+// Empty namespace in all functions of the package is all namespaces of the
+// cluster, releases are matched between clusters by name then.
 
-	// Initialize the Helm client configuration
-	if err := actionConfig.Init(configFlags, namespace, os.Getenv("HELM_DRIVER"), klog.Infof); err != nil {
-		fmt.Println("Failed to initialize Helm client configuration in GetHelmReleasesPerNS")
+// listReleases returns the latest revision of every release in the namespace (all
+// namespaces for empty one), including failed and pending releases
+func listReleases(cluster, kubeconfig, namespace string) ([]*release.Release, error) {
+	// Get the Helm client configuration of the cluster (built once and reused)
+	actionConfig, err := k8s.HelmConfig(cluster, kubeconfig, namespace)
+	if err != nil {
 		return nil, err
 	}
-
-	// Create the Helm list client
 	listClient := action.NewList(actionConfig)
-
-	// Configure the Helm list client
 	listClient.All = true
+	listClient.AllNamespaces = namespace == ""
+	return listClient.Run()
+}
 
-	// Run the Helm list command
-	results, err := listClient.Run()
+// releaseNamespace returns namespace of the release found in all namespaces
+func releaseNamespace(cluster, kubeconfig, releaseName string) (string, error) {
+	results, err := listReleases(cluster, kubeconfig, "")
 	if err != nil {
-		fmt.Println("Failed to list Helm releases in GetHelmReleasesPerNS")
-		return nil, err
+		return "", err
+	}
+	for _, rel := range results {
+		if rel.Name == releaseName {
+			return rel.Namespace, nil
+		}
+	}
+	return "", driver.ErrReleaseNotFound
+}
+
+func GetHelmReleasesPerNS(ctx context.Context, cluster, kubeconfig string, namespace string) ([]string, error) {
+	var releases []string
+
+	// snapshot keeps release values, release names are taken from them
+	if k8s.IsOffline(kubeconfig) {
+		values, err := k8s.OfflineObjects(kubeconfig, namespace, k8s.SnapshotHelmValues)
+		if err != nil {
+			return nil, k8s.Classify(cluster, "helm releases", err)
+		}
+		for _, value := range values {
+			if name, ok := value.Object["releaseName"].(string); ok {
+				releases = append(releases, name)
+			}
+		}
+		return releases, nil
+	}
+
+	results, err := listReleases(cluster, kubeconfig, namespace)
+	if err != nil {
+		log.Println("Failed to list Helm releases in GetHelmReleasesPerNS")
+		return nil, k8s.Classify(cluster, "helm releases", err)
 	}
 
 	// Output the results
@@ -48,43 +75,152 @@ func GetHelmReleasesPerNS(cluster, kubeconfig string, namespace string) ([]strin
 	return releases, nil
 }
 
-func GetHelmReleasesJsonPerNS(cluster, kubeconfig string, namespace string) ([]unstructured.Unstructured, error) {
-	releaseNames, err := GetHelmReleasesPerNS(cluster, kubeconfig, namespace)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get helm release names for GetHelmReleasesJsonPerNS: %v", err)
+func GetHelmReleasesJsonPerNS(ctx context.Context, cluster, kubeconfig string, namespace string) ([]unstructured.Unstructured, error) {
+	if k8s.IsOffline(kubeconfig) {
+		values, err := k8s.OfflineObjects(kubeconfig, namespace, k8s.SnapshotHelmValues)
+		return values, k8s.Classify(cluster, "helm values", err)
 	}
 
-	// Create a new config flags object
-	configFlags := genericclioptions.NewConfigFlags(true)
-	// Set the kubeconfig path
-	configFlags.KubeConfig = &kubeconfig
-
-	// Create the Helm client configuration
-	actionConfig := new(action.Configuration)
-
-	// Initialize the Helm client configuration
-	if err := actionConfig.Init(configFlags, namespace, os.Getenv("HELM_DRIVER"), klog.Infof); err != nil {
-		fmt.Println("Failed to initialize Helm client configuration for GetHelmReleasesJsonPerNS")
-		return nil, err
+	results, err := listReleases(cluster, kubeconfig, namespace)
+	if err != nil {
+		log.Println("Failed to list Helm releases in GetHelmReleasesJsonPerNS")
+		return nil, k8s.Classify(cluster, "helm values", err)
 	}
 
-	// Create the Helm GetValues client
-	getValuesClient := action.NewGetValues(actionConfig)
-
 	var unstructuredValues []unstructured.Unstructured
-	for _, releaseName := range releaseNames {
-		releaseValues, err := getValuesClient.Run(releaseName)
-		if err != nil {
-			fmt.Println("Failed to get values for Helm release in GetHelmReleasesJsonPerNS", releaseName)
-			return nil, err
-		}
-		if releaseValues == nil {
-			releaseValues = make(map[string]interface{})
+	for _, rel := range results {
+		// user supplied values of the latest revision, the same as `helm get values`
+		releaseValues := make(map[string]interface{}, len(rel.Config)+1)
+		for key, value := range rel.Config {
+			releaseValues[key] = value
 		}
 		// Add the release name to the values
-		releaseValues["releaseName"] = releaseName
+		releaseValues["releaseName"] = rel.Name
 		unstructuredValue := unstructured.Unstructured{Object: releaseValues}
 		unstructuredValues = append(unstructuredValues, unstructuredValue)
 	}
 	return unstructuredValues, nil
 }
+
+// GetHelmReleasesInfoPerNS returns the latest revision of every release in the
+// namespace: chart, app version, status, number of revisions, last deploy time,
+// all values (chart defaults merged) and objects of the rendered manifest by "Kind/name"
+func GetHelmReleasesInfoPerNS(ctx context.Context, cluster, kubeconfig string, namespace string) ([]unstructured.Unstructured, error) {
+	if k8s.IsOffline(kubeconfig) {
+		releases, err := k8s.OfflineObjects(kubeconfig, namespace, k8s.SnapshotHelmReleases)
+		return releases, k8s.Classify(cluster, "helm releases", err)
+	}
+
+	results, err := listReleases(cluster, kubeconfig, namespace)
+	if err != nil {
+		log.Println("Failed to list Helm releases in GetHelmReleasesInfoPerNS")
+		return nil, k8s.Classify(cluster, "helm releases", err)
+	}
+
+	var releases []unstructured.Unstructured
+	for _, rel := range results {
+		// helm actions do not take context, so stop between releases when request is cancelled
+		if err := ctx.Err(); err != nil {
+			return nil, k8s.Classify(cluster, "helm releases", err)
+		}
+		// history is read in the namespace of the release, releases of all namespaces
+		// can have the same name
+		actionConfig, err := k8s.HelmConfig(cluster, kubeconfig, rel.Namespace)
+		if err != nil {
+			return nil, k8s.Classify(cluster, "helm releases", err)
+		}
+		history, err := action.NewHistory(actionConfig).Run(rel.Name)
+		if err != nil {
+			log.Println("Failed to get history of Helm release in GetHelmReleasesInfoPerNS", rel.Name)
+			return nil, k8s.Classify(cluster, "helm releases", err)
+		}
+		info, err := releaseInfo(rel, len(history))
+		if err != nil {
+			log.Println("Failed to read Helm release in GetHelmReleasesInfoPerNS", rel.Name, err)
+			return nil, k8s.Classify(cluster, "helm releases", err)
+		}
+		releases = append(releases, info)
+	}
+	return releases, nil
+}
+
+// releaseInfo returns compared fields of the release, every top level field is a report section
+func releaseInfo(rel *release.Release, revisions int) (unstructured.Unstructured, error) {
+	allValues, err := coalescedValues(rel.Chart, rel.Config)
+	if err != nil {
+		return unstructured.Unstructured{}, err
+	}
+	manifest, err := manifestObjects(rel)
+	if err != nil {
+		return unstructured.Unstructured{}, err
+	}
+
+	var status, lastDeployed string
+	if rel.Info != nil {
+		status = rel.Info.Status.String()
+		lastDeployed = rel.Info.LastDeployed.UTC().Format(time.RFC3339)
+	}
+	var metadata chart.Metadata
+	if rel.Chart != nil && rel.Chart.Metadata != nil {
+		metadata = *rel.Chart.Metadata
+	}
+	return unstructured.Unstructured{Object: map[string]interface{}{
+		"releaseName": rel.Name,
+		"chart": map[string]interface{}{
+			"name":       metadata.Name,
+			"version":    metadata.Version,
+			"appVersion": metadata.AppVersion,
+		},
+		"status":       status,
+		"revisions":    int64(revisions),
+		"lastDeployed": lastDeployed,
+		"values":       allValues,
+		"manifest":     manifest,
+	}}, nil
+}
+
+// GetHelmReleaseManifestsPerNS returns objects of the rendered manifest of every
+// release in the namespace, {"releaseName": name, "manifest": {"Kind/name": object}}
+func GetHelmReleaseManifestsPerNS(ctx context.Context, cluster, kubeconfig string, namespace string) ([]unstructured.Unstructured, error) {
+	// snapshots keep manifests as a part of helm releases
+	if k8s.IsOffline(kubeconfig) {
+		releases, err := k8s.OfflineObjects(kubeconfig, namespace, k8s.SnapshotHelmReleases)
+		return releases, k8s.Classify(cluster, "helm manifests", err)
+	}
+
+	results, err := listReleases(cluster, kubeconfig, namespace)
+	if err != nil {
+		log.Println("Failed to list Helm releases in GetHelmReleaseManifestsPerNS")
+		return nil, k8s.Classify(cluster, "helm manifests", err)
+	}
+
+	var releases []unstructured.Unstructured
+	for _, rel := range results {
+		if err := ctx.Err(); err != nil {
+			return nil, k8s.Classify(cluster, "helm manifests", err)
+		}
+		manifest, err := manifestObjects(rel)
+		if err != nil {
+			log.Println("Failed to parse manifest of Helm release in GetHelmReleaseManifestsPerNS", rel.Name, err)
+			return nil, k8s.Classify(cluster, "helm manifests", err)
+		}
+		releases = append(releases, unstructured.Unstructured{Object: map[string]interface{}{
+			"releaseName": rel.Name,
+			"manifest":    manifest,
+		}})
+	}
+	return releases, nil
+}
+
+// manifestObjects splits the release manifest into objects by "Kind/name"
+func manifestObjects(rel *release.Release) (map[string]interface{}, error) {
+	objects, err := k8s.ParseManifests([]byte(rel.Manifest))
+	if err != nil {
+		return nil, err
+	}
+	manifest := make(map[string]interface{}, len(objects))
+	for _, obj := range objects {
+		manifest[obj.GetKind()+"/"+obj.GetName()] = obj.Object
+	}
+	return manifest, nil
+}
@@ -0,0 +1,61 @@
+package helm
+
+import (
+	"compareapp/k8s"
+	"context"
+	"sort"
+	"time"
+
+	"helm.sh/helm/v3/pkg/action"
+)
+
+// Revision is one entry of the release history, like a row of `helm history`
+type Revision struct {
+	Revision    int       `json:"revision"`
+	Updated     time.Time `json:"updated"`
+	Status      string    `json:"status"`
+	Chart       string    `json:"chart"`
+	AppVersion  string    `json:"appVersion"`
+	Description string    `json:"description"`
+}
+
+// GetReleaseHistory returns revisions of the release kept by helm, newest first
+func GetReleaseHistory(ctx context.Context, cluster, kubeconfig, namespace, releaseName string) ([]Revision, error) {
+	if k8s.IsOffline(kubeconfig) {
+		return nil, k8s.Classify(cluster, "helm history", k8s.OfflineUnsupported(kubeconfig, "helm histories"))
+	}
+	if namespace == "" {
+		var err error
+		if namespace, err = releaseNamespace(cluster, kubeconfig, releaseName); err != nil {
+			return nil, k8s.Classify(cluster, "helm history", err)
+		}
+	}
+	actionConfig, err := k8s.HelmConfig(cluster, kubeconfig, namespace)
+	if err != nil {
+		return nil, k8s.Classify(cluster, "helm history", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, k8s.Classify(cluster, "helm history", err)
+	}
+	releases, err := action.NewHistory(actionConfig).Run(releaseName)
+	if err != nil {
+		return nil, k8s.Classify(cluster, "helm history", err)
+	}
+
+	history := make([]Revision, 0, len(releases))
+	for _, rel := range releases {
+		revision := Revision{Revision: rel.Version}
+		if rel.Chart != nil && rel.Chart.Metadata != nil {
+			revision.Chart = rel.Chart.Metadata.Name + "-" + rel.Chart.Metadata.Version
+			revision.AppVersion = rel.Chart.Metadata.AppVersion
+		}
+		if rel.Info != nil {
+			revision.Updated = rel.Info.LastDeployed.Time
+			revision.Status = rel.Info.Status.String()
+			revision.Description = rel.Info.Description
+		}
+		history = append(history, revision)
+	}
+	sort.Slice(history, func(i, j int) bool { return history[i].Revision > history[j].Revision })
+	return history, nil
+}
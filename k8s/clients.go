@@ -0,0 +1,289 @@
+package k8s
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/klog/v2"
+)
+
+// Every fetcher gets clients here. Clusters are selected by context name (the
+// key of the cluster picker), so two contexts of one kubeconfig file (~/.kube/config)
+// are really two different clusters. Empty context name means the current context
+// of the kubeconfig. Clients are built once per cluster and reused by all requests
+// until the kubeconfig file is changed.
+
+// ClientSettings are applied to every client built by the registry
+type ClientSettings struct {
+	QPS   float32
+	Burst int
+	// Timeout of one request to the cluster API
+	Timeout time.Duration
+	// Parallelism is how many API calls of one page run at the same time
+	Parallelism int
+}
+
+var defaultClientSettings = ClientSettings{QPS: 50, Burst: 100, Timeout: 5 * time.Second, Parallelism: 8}
+
+// Clients of one cluster (context of kubeconfig)
+type Clients struct {
+	Config    *rest.Config
+	Clientset *kubernetes.Clientset
+	Dynamic   dynamic.Interface
+	Metadata  metadata.Interface // lists only object metadata, used for counting
+	Discovery discovery.CachedDiscoveryInterface
+	Mapper    meta.RESTMapper
+
+	contextName string
+	configPath  string
+	version     string // kubeconfig version the clients are built from
+
+	mu   sync.Mutex
+	helm map[string]*action.Configuration // by namespace and storage driver
+}
+
+var clientRegistry = struct {
+	sync.Mutex
+	settings ClientSettings
+	clients  map[string]*Clients
+}{settings: defaultClientSettings, clients: make(map[string]*Clients)}
+
+// SetClientSettings changes QPS/Burst/timeout/parallelism, zero values keep defaults.
+// Already built clients are dropped.
+func SetClientSettings(settings ClientSettings) {
+	if settings.QPS <= 0 {
+		settings.QPS = defaultClientSettings.QPS
+	}
+	if settings.Burst <= 0 {
+		settings.Burst = defaultClientSettings.Burst
+	}
+	if settings.Timeout <= 0 {
+		settings.Timeout = defaultClientSettings.Timeout
+	}
+	if settings.Parallelism <= 0 {
+		settings.Parallelism = defaultClientSettings.Parallelism
+	}
+	clientRegistry.Lock()
+	clientRegistry.settings = settings
+	clientRegistry.clients = make(map[string]*Clients)
+	clientRegistry.Unlock()
+}
+
+// RequestTimeout returns timeout of one request to the cluster API
+func RequestTimeout() time.Duration {
+	clientRegistry.Lock()
+	defer clientRegistry.Unlock()
+	return clientRegistry.settings.Timeout
+}
+
+// Parallelism returns how many API calls of one page run at the same time
+func Parallelism() int {
+	clientRegistry.Lock()
+	defer clientRegistry.Unlock()
+	return clientRegistry.settings.Parallelism
+}
+
+// GetClients returns clients for the context of kubeconfig (file or uploaded one)
+func GetClients(contextName, configPath string) (*Clients, error) {
+	version, err := kubeconfigVersion(configPath)
+	if err != nil {
+		return nil, kubeconfigError{err}
+	}
+	key := configPath + "\x00" + contextName
+
+	clientRegistry.Lock()
+	defer clientRegistry.Unlock()
+	if c, ok := clientRegistry.clients[key]; ok && c.version == version {
+		return c, nil
+	}
+	c, err := newClients(contextName, configPath, clientRegistry.settings)
+	if err != nil {
+		return nil, kubeconfigError{err}
+	}
+	c.version = version
+	clientRegistry.clients[key] = c
+	return c, nil
+}
+
+// forgetClients drops clients built from the kubeconfig
+func forgetClients(configPath string) {
+	clientRegistry.Lock()
+	defer clientRegistry.Unlock()
+	for key, c := range clientRegistry.clients {
+		if c.configPath == configPath {
+			delete(clientRegistry.clients, key)
+		}
+	}
+}
+
+// kubeconfigVersion changes every time kubeconfig file is changed, uploaded
+// kubeconfigs are never changed after upload
+func kubeconfigVersion(configPath string) (string, error) {
+	if strings.HasPrefix(configPath, memoryConfigPrefix) {
+		return "", nil
+	}
+	info, err := os.Stat(configPath)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprint(info.ModTime().UnixNano(), "/", info.Size()), nil
+}
+
+func newClients(contextName, configPath string, settings ClientSettings) (*Clients, error) {
+	config, err := RESTConfig(contextName, configPath)
+	if err != nil {
+		return nil, err
+	}
+	config.QPS = settings.QPS
+	config.Burst = settings.Burst
+	config.Timeout = settings.Timeout
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	metadataClient, err := metadata.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	discoveryClient := memory.NewMemCacheClient(clientset.Discovery())
+	return &Clients{
+		Config:      config,
+		Clientset:   clientset,
+		Dynamic:     dynamicClient,
+		Metadata:    metadataClient,
+		Discovery:   discoveryClient,
+		Mapper:      restmapper.NewDeferredDiscoveryRESTMapper(discoveryClient),
+		contextName: contextName,
+		configPath:  configPath,
+		helm:        make(map[string]*action.Configuration),
+	}, nil
+}
+
+// RESTConfig returns rest config for the context of kubeconfig, it is not cached
+func RESTConfig(contextName, configPath string) (*rest.Config, error) {
+	config, err := loadKubeconfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if contextName != "" {
+		if _, ok := config.Contexts[contextName]; !ok {
+			return nil, fmt.Errorf("context %q not found in kubeconfig %s", contextName, configPath)
+		}
+	}
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: contextName}
+	return clientcmd.NewDefaultClientConfig(*config, overrides).ClientConfig()
+}
+
+// CurrentContext returns name of the current context of kubeconfig
+func CurrentContext(configPath string) (string, error) {
+	config, err := loadKubeconfig(configPath)
+	if err != nil {
+		return "", err
+	}
+	if config.CurrentContext == "" {
+		return "", fmt.Errorf("kubeconfig %s has no current context", configPath)
+	}
+	return config.CurrentContext, nil
+}
+
+// HelmConfig returns helm action configuration for the namespace, empty namespace
+// is all namespaces. Storage driver is taken from the cluster settings, HELM_DRIVER
+// as helm cli does when the cluster has none.
+func (c *Clients) HelmConfig(namespace string) (*action.Configuration, error) {
+	settings := clusterSettingsOf(c.contextName)
+	if settings.HelmDriver == "" {
+		settings.HelmDriver = os.Getenv("HELM_DRIVER")
+		settings.HelmSQLConnection = os.Getenv("HELM_DRIVER_SQL_CONNECTION_STRING")
+	}
+	key := namespace + "/" + settings.HelmDriver + "/" + settings.HelmSQLConnection
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if actionConfig, ok := c.helm[key]; ok {
+		return actionConfig, nil
+	}
+	actionConfig := new(action.Configuration)
+	if settings.HelmDriver == "sql" {
+		// helm reads connection string of sql driver only from env, so the storage
+		// is replaced after init with the connection of the cluster
+		if err := actionConfig.Init(c.RESTClientGetter(namespace), namespace, "memory", klog.Infof); err != nil {
+			return nil, err
+		}
+		sqlDriver, err := driver.NewSQL(settings.HelmSQLConnection, klog.Infof, namespace)
+		if err != nil {
+			return nil, fmt.Errorf("helm sql storage of %s: %v", c.contextName, err)
+		}
+		actionConfig.Releases = storage.Init(sqlDriver)
+	} else if err := actionConfig.Init(c.RESTClientGetter(namespace), namespace, settings.HelmDriver, klog.Infof); err != nil {
+		return nil, err
+	}
+	c.helm[key] = actionConfig
+	return actionConfig, nil
+}
+
+// HelmConfig returns cached helm action configuration for the context of kubeconfig
+func HelmConfig(contextName, configPath, namespace string) (*action.Configuration, error) {
+	c, err := GetClients(contextName, configPath)
+	if err != nil {
+		return nil, err
+	}
+	return c.HelmConfig(namespace)
+}
+
+// RESTClientGetter returns client getter for helm sharing clients of the cluster
+func (c *Clients) RESTClientGetter(namespace string) genericclioptions.RESTClientGetter {
+	return &clientsGetter{clients: c, namespace: namespace}
+}
+
+type clientsGetter struct {
+	clients   *Clients
+	namespace string
+}
+
+func (g *clientsGetter) ToRawKubeConfigLoader() clientcmd.ClientConfig {
+	config, err := loadKubeconfig(g.clients.configPath)
+	if err != nil {
+		// helm calls the loader without checking for nil, so give it empty config
+		// which returns the error on first use
+		config = clientcmdapi.NewConfig()
+	}
+	overrides := &clientcmd.ConfigOverrides{
+		CurrentContext: g.clients.contextName,
+		Context:        clientcmdapi.Context{Namespace: g.namespace},
+	}
+	return clientcmd.NewDefaultClientConfig(*config, overrides)
+}
+
+func (g *clientsGetter) ToRESTConfig() (*rest.Config, error) {
+	return rest.CopyConfig(g.clients.Config), nil
+}
+
+func (g *clientsGetter) ToDiscoveryClient() (discovery.CachedDiscoveryInterface, error) {
+	return g.clients.Discovery, nil
+}
+
+func (g *clientsGetter) ToRESTMapper() (meta.RESTMapper, error) {
+	return g.clients.Mapper, nil
+}
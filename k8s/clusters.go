@@ -0,0 +1,49 @@
+package k8s
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ClusterSettings are settings of one cluster from the "clusters" section of
+// config, the key is the name of the cluster in the picker (kubeconfig context)
+type ClusterSettings struct {
+	// HelmDriver is the storage of helm releases: secret (default), configmap or sql
+	HelmDriver string `json:"helm_driver"`
+	// HelmSQLConnection is the postgres connection string of the sql driver
+	HelmSQLConnection string `json:"helm_sql_connection"`
+}
+
+var clusterSettings = struct {
+	sync.RWMutex
+	byCluster map[string]ClusterSettings
+}{byCluster: make(map[string]ClusterSettings)}
+
+// SetClusterSettings checks and sets settings of clusters, helm configurations
+// already built with other drivers are not used anymore
+func SetClusterSettings(settings map[string]ClusterSettings) error {
+	byCluster := make(map[string]ClusterSettings, len(settings))
+	for cluster, s := range settings {
+		switch s.HelmDriver {
+		case "", "secret", "secrets", "configmap", "configmaps", "memory":
+		case "sql":
+			if s.HelmSQLConnection == "" {
+				return fmt.Errorf("cluster %s: helm_sql_connection is required for sql helm driver", cluster)
+			}
+		default:
+			// helm panics on unknown drivers
+			return fmt.Errorf("cluster %s: unknown helm_driver %q, expected secret, configmap or sql", cluster, s.HelmDriver)
+		}
+		byCluster[cluster] = s
+	}
+	clusterSettings.Lock()
+	clusterSettings.byCluster = byCluster
+	clusterSettings.Unlock()
+	return nil
+}
+
+func clusterSettingsOf(cluster string) ClusterSettings {
+	clusterSettings.RLock()
+	defer clusterSettings.RUnlock()
+	return clusterSettings.byCluster[cluster]
+}
@@ -0,0 +1,113 @@
+package k8s
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+)
+
+// APIResource is a namespaced resource of the cluster which can be listed
+type APIResource struct {
+	Group    string `json:"group"`
+	Version  string `json:"version"`
+	Resource string `json:"resource"`
+	Kind     string `json:"kind"` // empty for snapshots, they keep only resource names
+}
+
+// GVR returns group, version and resource of the resource
+func (r APIResource) GVR() schema.GroupVersionResource {
+	return schema.GroupVersionResource{Group: r.Group, Version: r.Version, Resource: r.Resource}
+}
+
+// NamespacedResources returns listable namespaced resources of the cluster in
+// their preferred versions, sorted by group and resource. Snapshots and manifests
+// return resources they have objects of.
+func NamespacedResources(ctx context.Context, cluster, configPath string) ([]APIResource, error) {
+	if IsOffline(configPath) {
+		source, err := openOffline(configPath)
+		if err != nil {
+			return nil, Classify(cluster, "api resources", err)
+		}
+		return source.Resources(), nil
+	}
+	clients, err := GetClients(cluster, configPath)
+	if err != nil {
+		log.Println("Failed to create client:", err)
+		return nil, Classify(cluster, "api resources", err)
+	}
+
+	client, err := clients.DiscoveryWithContext(ctx)
+	if err != nil {
+		return nil, Classify(cluster, "api resources", err)
+	}
+	// partial result is returned when some api groups are unavailable (broken metrics-server etc.)
+	lists, err := client.ServerPreferredNamespacedResources()
+	if err != nil && len(lists) == 0 {
+		log.Println("Failed to get API resources:", err)
+		return nil, Classify(cluster, "api resources", err)
+	}
+
+	var resources []APIResource
+	for _, list := range lists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			continue
+		}
+		for _, resource := range list.APIResources {
+			if strings.Contains(resource.Name, "/") || !containsString(resource.Verbs, "list") {
+				continue // subresources and resources which can't be listed
+			}
+			resources = append(resources, APIResource{Group: gv.Group, Version: gv.Version, Resource: resource.Name, Kind: resource.Kind})
+		}
+	}
+	sortResources(resources)
+	return resources, nil
+}
+
+// DiscoveryWithContext returns discovery client whose requests are cancelled with
+// ctx, discovery methods of client-go don't take the request context
+func (c *Clients) DiscoveryWithContext(ctx context.Context) (*discovery.DiscoveryClient, error) {
+	config := rest.CopyConfig(c.Config)
+	config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+		return contextRoundTripper{ctx: ctx, next: rt}
+	})
+	return discovery.NewDiscoveryClientForConfig(config)
+}
+
+type contextRoundTripper struct {
+	ctx  context.Context
+	next http.RoundTripper
+}
+
+func (t contextRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.next.RoundTrip(req.WithContext(t.ctx))
+}
+
+func sortResources(resources []APIResource) {
+	sort.Slice(resources, func(i, j int) bool {
+		if resources[i].Group != resources[j].Group {
+			return resources[i].Group < resources[j].Group
+		}
+		return resources[i].Resource < resources[j].Resource
+	})
+}
+
+// parseSnapshotResource parses resource like "apps/v1/deployments" or "v1/services"
+func parseSnapshotResource(resource string) (APIResource, bool) {
+	parts := strings.Split(resource, "/")
+	switch {
+	case strings.HasPrefix(resource, "helm/"):
+		return APIResource{}, false
+	case len(parts) == 2:
+		return APIResource{Version: parts[0], Resource: parts[1]}, true
+	case len(parts) == 3:
+		return APIResource{Group: parts[0], Version: parts[1], Resource: parts[2]}, true
+	}
+	return APIResource{}, false
+}
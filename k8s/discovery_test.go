@@ -0,0 +1,44 @@
+package k8s
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/rest"
+)
+
+func TestDiscoveryWithContextCancelled(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	clients := &Clients{Config: &rest.Config{Host: server.URL}}
+	ctx, cancel := context.WithCancel(context.Background())
+	client, err := clients.DiscoveryWithContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.ServerGroups()
+		done <- err
+	}()
+	cancel()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("ServerGroups() error = nil after the context is cancelled")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("discovery is not cancelled with the context")
+	}
+}
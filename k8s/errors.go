@@ -0,0 +1,123 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Reason is why objects could not be read from the cluster
+type Reason string
+
+const (
+	ReasonUnreachable    Reason = "unreachable"
+	ReasonUnauthorized   Reason = "unauthorized"
+	ReasonForbidden      Reason = "forbidden"
+	ReasonNotInstalled   Reason = "CRD not installed"
+	ReasonTimeout        Reason = "timeout"
+	ReasonCancelled      Reason = "cancelled"
+	ReasonKubeconfig     Reason = "kubeconfig error"
+	ReasonNotCaptured    Reason = "not in snapshot"
+	ReasonNotInManifests Reason = "not in manifests"
+	ReasonUnknown        Reason = "error"
+)
+
+// APIError is returned by every fetcher, so the report can tell "could not read
+// Canaries in cluster B: forbidden" instead of showing all objects as missing
+type APIError struct {
+	Reason   Reason
+	Cluster  string
+	Resource string
+	Err      error
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("could not read %s in cluster %s: %s (%v)", e.Resource, e.Cluster, e.Reason, e.Err)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// kubeconfigError marks errors of loading kubeconfig and building clients
+type kubeconfigError struct{ err error }
+
+func (e kubeconfigError) Error() string { return e.err.Error() }
+func (e kubeconfigError) Unwrap() error { return e.err }
+
+// Classify wraps error of reading resource from the cluster into APIError,
+// nil stays nil and APIError is returned as is
+func Classify(cluster, resource string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	return &APIError{Reason: reasonOf(err), Cluster: cluster, Resource: resource, Err: err}
+}
+
+// ReasonOf returns reason of the fetcher error, ReasonUnknown for other errors
+func ReasonOf(err error) Reason {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Reason
+	}
+	return reasonOf(err)
+}
+
+// ClusterOf returns cluster of the fetcher error
+func ClusterOf(err error) string {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Cluster
+	}
+	return ""
+}
+
+// ResourceOf returns resource of the fetcher error
+func ResourceOf(err error) string {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Resource
+	}
+	return ""
+}
+
+// IsNotInstalled is true when the resource type is not served by the cluster
+func IsNotInstalled(err error) bool {
+	return err != nil && ReasonOf(err) == ReasonNotInstalled
+}
+
+func reasonOf(err error) Reason {
+	var kubeconfigErr kubeconfigError
+	var offlineErr offlineError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &offlineErr):
+		return offlineErr.reason
+	case errors.As(err, &kubeconfigErr):
+		return ReasonKubeconfig
+	case errors.Is(err, context.Canceled):
+		return ReasonCancelled
+	case errors.Is(err, context.DeadlineExceeded), apierrors.IsTimeout(err), apierrors.IsServerTimeout(err):
+		return ReasonTimeout
+	case apierrors.IsUnauthorized(err):
+		return ReasonUnauthorized
+	case apierrors.IsForbidden(err):
+		return ReasonForbidden
+	case apierrors.IsNotFound(err):
+		// list of a resource type returns 404 only when the type is not served
+		return ReasonNotInstalled
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			return ReasonTimeout
+		}
+		return ReasonUnreachable
+	}
+	return ReasonUnknown
+}
@@ -2,18 +2,16 @@ package k8s
 
 import (
 	"context"
-	"fmt"
+	"encoding/json"
 	"log"
 	"os"
 	"path/filepath"
-	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/client-go/dynamic"
-	"k8s.io/client-go/kubernetes"
+	apiversion "k8s.io/apimachinery/pkg/version"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
@@ -22,9 +20,6 @@ type Cluster struct {
 	ConfigPath string
 }
 
-// cluster_name:path_to_kubeconfig (map[dev-pcidss:conf/cloud.paa.kubeconfig new-test-dss:conf/new.paa.kubeconfig])
-var clusterConfigPaths = make(map[string]string)
-
 func getClusterConfig(configDir string) []Cluster {
 	configFiles, err := filepath.Glob(filepath.Join(configDir, "*.kubeconfig"))
 	if err != nil {
@@ -47,11 +42,10 @@ func getClusterConfig(configDir string) []Cluster {
 			continue
 		}
 
-		clusterName := context.Cluster
-		cluster := Cluster{Name: clusterName, ConfigPath: configFile}
+		cluster := Cluster{Name: contextName, ConfigPath: configFile}
 		clusters1 = append(clusters1, cluster)
 		// print path to kubeconfig file
-		fmt.Println("Config Path for Cluster", clusterName+":", configFile)
+		log.Println("Config Path for Cluster", context.Cluster, "(context "+contextName+"):", configFile)
 
 	}
 
@@ -61,35 +55,41 @@ func getClusterConfig(configDir string) []Cluster {
 func getClusterConfigHome(conf1 string) []Cluster {
 	config, err := clientcmd.LoadFromFile(conf1)
 	if err != nil {
-		log.Fatalf("Error loading config file: %v", err)
+		log.Println("Error loading config file:", err)
+		return nil
 	}
 
 	clusters := make([]Cluster, 0, len(config.Contexts))
-	for _, context := range config.Contexts {
-		clusterName := context.Cluster
-		cluster := Cluster{Name: clusterName, ConfigPath: conf1}
+	for contextName, context := range config.Contexts {
+		cluster := Cluster{Name: contextName, ConfigPath: conf1}
 		clusters = append(clusters, cluster)
 		// print path to kubeconfig file
-		fmt.Println("Config Path for Cluster", clusterName+":", conf1)
+		log.Println("Config Path for Cluster", context.Cluster, "(context "+contextName+"):", conf1)
 	}
 
 	return clusters
 }
 
+// SetClusterConfig returns context_name:path_to_kubeconfig (map[dev-pcidss:conf/cloud.paa.kubeconfig new-test-dss:conf/new.paa.kubeconfig]),
+// clusters are picked by context name, ~/.kube/config has many contexts in one file
 func SetClusterConfig() map[string]string {
-	clusterConfigPaths = make(map[string]string)
+	clusterConfigPaths := make(map[string]string)
 	Clusters1 := getClusterConfig("./conf/kubeconfig")
 	for _, cluster := range Clusters1 {
+		if configPath, ok := clusterConfigPaths[cluster.Name]; ok {
+			log.Println("Context", cluster.Name, "is current in both", configPath, "and", cluster.ConfigPath+", the last one is used")
+		}
 		clusterConfigPaths[cluster.Name] = cluster.ConfigPath
 	}
 	return clusterConfigPaths
 }
 
 func SetClusterConfigHome() map[string]string {
-	clusterConfigPaths = make(map[string]string)
+	clusterConfigPaths := make(map[string]string)
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		log.Fatal(err)
+		log.Println(err)
+		return clusterConfigPaths
 	}
 
 	kubeConfigPath := filepath.Join(homeDir, ".kube", "config")
@@ -100,41 +100,35 @@ func SetClusterConfigHome() map[string]string {
 	return clusterConfigPaths
 }
 
-func ClusterVersion(cluster, configPath string, returnSlice bool) (interface{}, error) {
-
-	config, err := clientcmd.LoadFromFile(configPath)
-	if err != nil {
-		fmt.Printf("Failed to load kubeconfig: %v\n", err)
-		return nil, err
-	}
-
-	// Find the context corresponding to the given cluster name
-	for contextName, context := range config.Contexts {
-		if context.Cluster == cluster {
-			// Set the current context to the found context
-			config.CurrentContext = contextName
-			break
+func ClusterVersion(ctx context.Context, cluster, configPath string, returnSlice bool) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, RequestTimeout()) // timeout wait cluster response
+	defer cancel()
+	if IsOffline(configPath) {
+		source, err := openOffline(configPath)
+		if err != nil {
+			return nil, Classify(cluster, "version", err)
 		}
+		if returnSlice {
+			return []string{source.KubernetesVersion()}, nil
+		}
+		return source.KubernetesVersion(), nil
 	}
-
-	// create api client configuration
-	clientcmdapiConfig := clientcmd.NewDefaultClientConfig(*config, &clientcmd.ConfigOverrides{})
-	clientConfig, err := clientcmdapiConfig.ClientConfig()
-	if err != nil {
-		fmt.Printf("Failed to create client config: %v\n", err)
-		return nil, err
-	}
-
-	clientset, err := kubernetes.NewForConfig(clientConfig)
+	clients, err := GetClients(cluster, configPath)
 	if err != nil {
-		fmt.Println("Failed to create clientset from config")
-		return nil, err
+		log.Println("Failed to create clientset from config")
+		return nil, Classify(cluster, "version", err)
 	}
 
-	version, err := clientset.Discovery().ServerVersion()
+	// the same as Discovery().ServerVersion() but with request context
+	body, err := clients.Clientset.Discovery().RESTClient().Get().AbsPath("/version").Do(ctx).Raw()
 	if err != nil {
 		log.Println("Failed to get server version:", err)
-		return nil, err
+		return nil, Classify(cluster, "version", err)
+	}
+	var version apiversion.Info
+	if err := json.Unmarshal(body, &version); err != nil {
+		log.Println("Failed to parse server version:", err)
+		return nil, Classify(cluster, "version", err)
 	}
 
 	clusterV := version.String()
@@ -144,11 +138,11 @@ func ClusterVersion(cluster, configPath string, returnSlice bool) (interface{},
 	return clusterV, nil
 }
 
-func GetAllClusterVersions(configPaths map[string]string) map[string]string {
+func GetAllClusterVersions(ctx context.Context, configPaths map[string]string) map[string]string {
 	clusterVersions := make(map[string]string)
 	for cluster, configPath := range configPaths {
 
-		versionInterface, err := ClusterVersion(cluster, configPath, true)
+		versionInterface, err := ClusterVersion(ctx, cluster, configPath, true)
 		if err != nil {
 			log.Println("Failed to get version for cluster", cluster, err)
 			log.Println("Delete unavailable cluster", cluster, configPath, "from list")
@@ -165,42 +159,26 @@ func GetAllClusterVersions(configPaths map[string]string) map[string]string {
 	return clusterVersions
 }
 
-func getNamespaces(cluster, configPath string) ([]string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second) // timeout wait cluster response
+func getNamespaces(ctx context.Context, cluster, configPath string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, RequestTimeout()) // timeout wait cluster response
 	defer cancel()
-
-	config, err := clientcmd.LoadFromFile(configPath)
-	if err != nil {
-		fmt.Printf("Failed to load kubeconfig: %v\n", err)
-		return nil, err
-	}
-
-	// Find the context corresponding to the given cluster name
-	for contextName, context := range config.Contexts {
-		if context.Cluster == cluster {
-			// Set the current context to the found context
-			config.CurrentContext = contextName
-			break
+	if IsOffline(configPath) {
+		source, err := openOffline(configPath)
+		if err != nil {
+			return nil, err
 		}
+		return source.Namespaces(), nil
 	}
 
-	// create api clients configuration
-	clientcmdapiConfig := clientcmd.NewDefaultClientConfig(*config, &clientcmd.ConfigOverrides{})
-	clientConfig, err := clientcmdapiConfig.ClientConfig()
-	if err != nil {
-		fmt.Printf("Failed to create client config: %v\n", err)
-		return nil, err
-	}
-
-	clientset, err := kubernetes.NewForConfig(clientConfig)
+	clients, err := GetClients(cluster, configPath)
 	if err != nil {
-		fmt.Println("Failed to create clientset from config when get NAMESPACES, cluster:", cluster)
+		log.Println("Failed to create clientset from config when get NAMESPACES, cluster:", cluster)
 		return nil, err
 	}
 
-	namespaceList, err := clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	namespaceList, err := clients.Clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
 	if err != nil {
-		fmt.Println("Failed to get namespace list for", cluster)
+		log.Println("Failed to get namespace list for", cluster)
 		return nil, err
 	}
 
@@ -212,55 +190,34 @@ func getNamespaces(cluster, configPath string) ([]string, error) {
 	return namespaces, nil
 }
 
-func FillNamespaces(cluster, configPath string) []string {
-	var clusterNamespaces []string
-	ns, err := getNamespaces(cluster, configPath)
+func FillNamespaces(ctx context.Context, cluster, configPath string) ([]string, error) {
+	ns, err := getNamespaces(ctx, cluster, configPath)
 	if err != nil {
 		log.Println("Error getting namespaces for cluster", cluster, err)
+		return nil, Classify(cluster, "namespaces", err)
 	}
-	clusterNamespaces = ns
-	return clusterNamespaces
+	return ns, nil
 }
 
-func GetNodesInfo(cluster, configPath string) (int, int, int, int64, int, error) {
+func GetNodesInfo(ctx context.Context, cluster, configPath string) (int, int, int, int64, error) {
 	totalCPUs := 0
 	totalMemory := 0
 	totalStorage := int64(0)
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second) // timeout wait cluster response
+	ctx, cancel := context.WithTimeout(ctx, RequestTimeout()) // timeout wait cluster response
 	defer cancel()
-	config, err := clientcmd.LoadFromFile(configPath)
-	if err != nil {
-		fmt.Printf("Failed to load kubeconfig: %v\n", err)
-		return 0, 0, 0, 0, 0, err
-	}
-
-	// Find the context corresponding to the given cluster name
-	for contextName, context := range config.Contexts {
-		if context.Cluster == cluster {
-			// Set the current context to the found context
-			config.CurrentContext = contextName
-			break
-		}
+	if IsOffline(configPath) {
+		return 0, 0, 0, 0, Classify(cluster, "nodes", OfflineUnsupported(configPath, "nodes"))
 	}
-
-	// create config API client
-	clientcmdapiConfig := clientcmd.NewDefaultClientConfig(*config, &clientcmd.ConfigOverrides{})
-	clientConfig, err := clientcmdapiConfig.ClientConfig()
+	clients, err := GetClients(cluster, configPath)
 	if err != nil {
-		fmt.Printf("Failed to create client config: %v\n", err)
-		return 0, 0, 0, 0, 0, err
+		log.Println("Failed to create clientset from config when get Nodes, cluster:", cluster)
+		return 0, 0, 0, 0, Classify(cluster, "nodes", err)
 	}
 
-	clientset, err := kubernetes.NewForConfig(clientConfig)
+	nodes, err := clients.Clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
 	if err != nil {
-		fmt.Println("Failed to create clientset from config when get Nodes, cluster:", cluster)
-		return 0, 0, 0, 0, 0, err
-	}
-
-	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
-	if err != nil {
-		fmt.Println(err)
-		return 0, 0, 0, 0, 0, err
+		log.Println(err)
+		return 0, 0, 0, 0, Classify(cluster, "nodes", err)
 	}
 
 	for _, node := range nodes.Items {
@@ -284,47 +241,50 @@ func GetNodesInfo(cluster, configPath string) (int, int, int, int64, int, error)
 
 	totalStorageGB := totalStorage / 1024 / 1024 / 1024
 
-	pods, err := clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{})
-	if err != nil {
-		fmt.Println("Failed to get pods")
-		return 0, 0, 0, 0, 0, err
-	}
-
-	totalPods := len(pods.Items)
-
-	return nodesNum, totalCPUs, totalMemoryGB, totalStorageGB, totalPods, nil
+	return nodesNum, totalCPUs, totalMemoryGB, totalStorageGB, nil
 }
 
-func GetAPIinfo(cluster, configPath string) (int, *metav1.APIGroupList, error) {
-
-	config, err := clientcmd.LoadFromFile(configPath)
+// CountPods returns number of pods in all namespaces, only names are requested
+func CountPods(ctx context.Context, cluster, configPath string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, RequestTimeout()) // timeout wait cluster response
+	defer cancel()
+	if IsOffline(configPath) {
+		return 0, Classify(cluster, "pods", OfflineUnsupported(configPath, "pods"))
+	}
+	clients, err := GetClients(cluster, configPath)
 	if err != nil {
-		fmt.Printf("Failed to load kubeconfig: %v\n", err)
+		log.Println("Failed to create clientset from config when get Pods, cluster:", cluster)
+		return 0, Classify(cluster, "pods", err)
 	}
 
-	// Find the context corresponding to the given cluster name
-	for contextName, context := range config.Contexts {
-		if context.Cluster == cluster {
-			// Set the current context to the found context
-			config.CurrentContext = contextName
-			break
-		}
+	gvr := schema.GroupVersionResource{Group: "", Version: "v1", Resource: "pods"}
+	pods, err := clients.Metadata.Resource(gvr).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		log.Println("Failed to get pods")
+		return 0, Classify(cluster, "pods", err)
 	}
+	return len(pods.Items), nil
+}
 
-	// create config API client
-	clientcmdapiConfig := clientcmd.NewDefaultClientConfig(*config, &clientcmd.ConfigOverrides{})
-	clientConfig, err := clientcmdapiConfig.ClientConfig()
-	if err != nil {
-		fmt.Printf("Failed to create client config: %v\n", err)
+func GetAPIinfo(ctx context.Context, cluster, configPath string) (int, *metav1.APIGroupList, error) {
+	if IsOffline(configPath) {
+		return 0, nil, Classify(cluster, "api resources", OfflineUnsupported(configPath, "api resources"))
 	}
 
-	clientset, err := kubernetes.NewForConfig(clientConfig)
+	clients, err := GetClients(cluster, configPath)
 	if err != nil {
-		fmt.Println("Failed to create clientset from config when get ApiResources, cluster:", cluster)
+		log.Println("Failed to create clientset from config when get ApiResources, cluster:", cluster)
+		return 0, nil, Classify(cluster, "api resources", err)
 	}
-	resources, err := clientset.Discovery().ServerPreferredResources()
+	client, err := clients.DiscoveryWithContext(ctx)
 	if err != nil {
-		fmt.Println("Failed to get API resources")
+		return 0, nil, Classify(cluster, "api resources", err)
+	}
+	// partial result is returned when some api groups are unavailable (broken metrics-server etc.)
+	resources, err := client.ServerPreferredResources()
+	if err != nil && len(resources) == 0 {
+		log.Println("Failed to get API resources")
+		return 0, nil, Classify(cluster, "api resources", err)
 	}
 
 	resourceMap := make(map[string]bool)
@@ -334,242 +294,127 @@ func GetAPIinfo(cluster, configPath string) (int, *metav1.APIGroupList, error) {
 		}
 	}
 
-	groups, err := clientset.Discovery().ServerGroups()
+	groups, err := client.ServerGroups()
 	if err != nil {
-		fmt.Printf("error")
+		log.Println("Failed to get API groups")
+		return 0, nil, Classify(cluster, "api groups", err)
 	}
 	apiNums := len(resourceMap)
 
-	return apiNums, groups, err
+	return apiNums, groups, nil
 }
-func GetCanaryPerNs(cluster, configPath string, namespace string) []string {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second) // timeout wait cluster response
-	defer cancel()
-	config, err := clientcmd.BuildConfigFromFlags("", configPath)
-	if err != nil {
-		fmt.Println("Failed to build config from kubeconfig file when get ApiResources, cluster:", cluster)
-	}
 
-	dynamicClient, err := dynamic.NewForConfig(config)
-	if err != nil {
-		fmt.Println("Failed to create client:", err)
-		return nil
-	}
-
-	gvr := schema.GroupVersionResource{Group: "flagger.app", Version: "v1beta1", Resource: "canaries"}
-	unstructuredList, err := dynamicClient.Resource(gvr).Namespace(namespace).List(ctx, metav1.ListOptions{})
-	if err != nil {
-		fmt.Println("Failed to get resources:", err)
-		return nil
-	}
-	// convert []unstructured.Unstructured to []string and return canary names
-	var canaryNames []string
-	for _, unstructuredObj := range unstructuredList.Items {
-		canaryNames = append(canaryNames, unstructuredObj.GetName())
-	}
-	return canaryNames
-}
-
-func GetCanaryObjectsPerNs(cluster, configPath string, namespace string) []unstructured.Unstructured {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second) // timeout wait cluster response
+// CountPerCluster returns number of objects of the resource in all namespaces
+// (used for CRDs like canaries and ingressroutes)
+func CountPerCluster(ctx context.Context, cluster, configPath string, group string, version string, resource string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, RequestTimeout()) // timeout wait cluster response
 	defer cancel()
-	config, err := clientcmd.BuildConfigFromFlags("", configPath)
-	if err != nil {
-		fmt.Println("Failed to build config from kubeconfig file when get ApiResources, cluster:", cluster)
-	}
-
-	dynamicClient, err := dynamic.NewForConfig(config)
-	if err != nil {
-		fmt.Println("Failed to create client:", err)
-		return nil
-	}
-
-	gvr := schema.GroupVersionResource{Group: "flagger.app", Version: "v1beta1", Resource: "canaries"}
-	unstructuredList, err := dynamicClient.Resource(gvr).Namespace(namespace).List(ctx, metav1.ListOptions{})
-	if err != nil {
-		fmt.Println("Failed to get resources:", err)
-		return nil
-	}
-
-	// return canary as []unstructured.Unstructured
-	return unstructuredList.Items
-}
-
-func GetPerCluster(cluster, configPath string) (int, int) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second) // timeout wait cluster response
-	defer cancel()
-	config, err := clientcmd.BuildConfigFromFlags("", configPath)
-	if err != nil {
-		fmt.Println("Failed to build config from kubeconfig file when get ApiResources, cluster:", cluster)
-		return 1, 1
-	}
-
-	dynamicClient, err := dynamic.NewForConfig(config)
-	if err != nil {
-		fmt.Println("Failed to create client:", err)
-		return 0, 0
+	if IsOffline(configPath) {
+		source, err := openOffline(configPath)
+		if err != nil {
+			return 0, Classify(cluster, resource, err)
+		}
+		count, err := source.Count(SnapshotResource(group, version, resource))
+		return count, Classify(cluster, resource, err)
 	}
-	// get canary from Cluster scope
-	gvr := schema.GroupVersionResource{Group: "flagger.app", Version: "v1beta1", Resource: "canaries"}
-	unstructuredList, err := dynamicClient.Resource(gvr).List(ctx, metav1.ListOptions{})
+	clients, err := GetClients(cluster, configPath)
 	if err != nil {
-		fmt.Println("Failed to get resources Flagger:", err)
-		return 0, 0
+		log.Println("Failed to create client:", err)
+		return 0, Classify(cluster, resource, err)
 	}
 
-	canaryNamesByNamespace := make(map[string][]string)
-	totalCanaryCount := 0
-	for _, unstructuredObj := range unstructuredList.Items {
-		namespace := unstructuredObj.GetNamespace()
-		name := unstructuredObj.GetName()
-		canaryNamesByNamespace[namespace] = append(canaryNamesByNamespace[namespace], name)
-		totalCanaryCount++
-	}
-	// get Traefik ingressroutes from Cluster scope
-	ing := schema.GroupVersionResource{Group: "traefik.containo.us", Version: "v1alpha1", Resource: "ingressroutes"}
-	ingList, err := dynamicClient.Resource(ing).List(ctx, metav1.ListOptions{})
+	gvr := schema.GroupVersionResource{Group: group, Version: version, Resource: resource}
+	list, err := clients.Metadata.Resource(gvr).List(ctx, metav1.ListOptions{})
 	if err != nil {
-		fmt.Println("Failed to get resources Traefik IngressRoutes:", err)
-		return 0, 0
+		log.Println("Failed to get resources", resource+":", err)
+		return 0, Classify(cluster, resource, err)
 	}
-	totalIngCount := len(ingList.Items)
-
-	return totalCanaryCount, totalIngCount
+	return len(list.Items), nil
 }
 
-func GetCanaryMetricTemplateObjectsPerNs(cluster, configPath string, namespace string) []unstructured.Unstructured {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second) // timeout wait cluster response
+// CountPerNamespace returns number of objects of the resource in the namespace
+func CountPerNamespace(ctx context.Context, cluster, configPath string, namespace string, group string, version string, resource string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, RequestTimeout()) // timeout wait cluster response
 	defer cancel()
-	config, err := clientcmd.BuildConfigFromFlags("", configPath)
-	if err != nil {
-		fmt.Println("Failed to build config from kubeconfig file when get MT for canary, cluster:", cluster)
+	if IsOffline(configPath) {
+		objects, err := OfflineObjects(configPath, namespace, SnapshotResource(group, version, resource))
+		return len(objects), Classify(cluster, resource, err)
 	}
-
-	dynamicClient, err := dynamic.NewForConfig(config)
+	clients, err := GetClients(cluster, configPath)
 	if err != nil {
-		fmt.Println("Failed to create client for get MT in flagger.app::", err)
-		return nil
+		log.Println("Failed to create client:", err)
+		return 0, Classify(cluster, resource, err)
 	}
 
-	gvr := schema.GroupVersionResource{Group: "flagger.app", Version: "v1beta1", Resource: "metrictemplates"}
-	unstructuredList, err := dynamicClient.Resource(gvr).Namespace(namespace).List(ctx, metav1.ListOptions{})
-	if err != nil {
-		fmt.Println("Failed to get resources metrictemplates in flagger.app:", err)
-		return nil
-	}
-
-	// return metrictemplates list as []unstructured.Unstructured
-	return unstructuredList.Items
-}
-
-func GetMTPerNs(cluster, configPath string, namespace string) []string {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second) // timeout wait cluster response
-	defer cancel()
-	config, err := clientcmd.BuildConfigFromFlags("", configPath)
-	if err != nil {
-		fmt.Println("Failed to build config from kubeconfig file when get MT for canary, cluster:", cluster)
-	}
-
-	dynamicClient, err := dynamic.NewForConfig(config)
-	if err != nil {
-		fmt.Println("Failed to create client for get MT in flagger.app:", err)
-		return nil
-	}
-
-	gvr := schema.GroupVersionResource{Group: "flagger.app", Version: "v1beta1", Resource: "metrictemplates"}
-	unstructuredList, err := dynamicClient.Resource(gvr).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	gvr := schema.GroupVersionResource{Group: group, Version: version, Resource: resource}
+	list, err := clients.Metadata.Resource(gvr).Namespace(namespace).List(ctx, metav1.ListOptions{})
 	if err != nil {
-		fmt.Println("Failed to get resources metrictemplates in flagger.app:", err)
-		return nil
-	}
-
-	// convert []unstructured.Unstructured to []string return names for metrictemplates
-	var mtNames []string
-	for _, unstructuredObj := range unstructuredList.Items {
-		mtNames = append(mtNames, unstructuredObj.GetName())
+		log.Println("Failed to get resources", resource+":", err)
+		return 0, Classify(cluster, resource, err)
 	}
-	return mtNames
+	return len(list.Items), nil
 }
 
-func GetDeployPerNs(cluster, configPath string, namespace string) []string {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second) // timeout wait cluster response
-	defer cancel()
-	config, err := clientcmd.BuildConfigFromFlags("", configPath)
-	if err != nil {
-		fmt.Println("Failed to build config from kubeconfig file when get Deployments:", cluster)
-	}
-
-	dynamicClient, err := dynamic.NewForConfig(config)
-	if err != nil {
-		fmt.Println("Failed to create client for get Deployments:", err)
-		return nil
-	}
-
-	gvr := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
-	unstructuredList, err := dynamicClient.Resource(gvr).Namespace(namespace).List(ctx, metav1.ListOptions{})
-	if err != nil {
-		fmt.Println("Failed to get resources deployments:", err)
-		return nil
-	}
-
-	// convert []unstructured.Unstructured to []string return deployments names
-	var deployNames []string
-	for _, unstructuredObj := range unstructuredList.Items {
-		deployNames = append(deployNames, unstructuredObj.GetName())
-	}
-	return deployNames
+func GetDeployPerNs(ctx context.Context, cluster, configPath string, namespace string) ([]string, error) {
+	return GetUniversalObjectPerNsAsString(ctx, cluster, configPath, namespace, "apps", "v1", "deployments")
 }
 
-func GetUniversalObjectsPerNsUnstruct(cluster, configPath string, namespace string, group string, version string, resource string) []unstructured.Unstructured {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second) // timeout wait cluster response
+func GetUniversalObjectsPerNsUnstruct(ctx context.Context, cluster, configPath string, namespace string, group string, version string, resource string) ([]unstructured.Unstructured, error) {
+	ctx, cancel := context.WithTimeout(ctx, RequestTimeout()) // timeout wait cluster response
 	defer cancel()
-	config, err := clientcmd.BuildConfigFromFlags("", configPath)
-	if err != nil {
-		fmt.Println("Failed to build config from kubeconfig file when get ApiResources, cluster:", cluster)
+	if IsOffline(configPath) {
+		objects, err := OfflineObjects(configPath, namespace, SnapshotResource(group, version, resource))
+		return objects, Classify(cluster, resource, err)
 	}
-
-	dynamicClient, err := dynamic.NewForConfig(config)
+	clients, err := GetClients(cluster, configPath)
 	if err != nil {
-		fmt.Println("Failed to create client:", err)
-		return nil
+		log.Println("Failed to create client:", err)
+		return nil, Classify(cluster, resource, err)
 	}
 
 	gvr := schema.GroupVersionResource{Group: group, Version: version, Resource: resource}
-	unstructuredList, err := dynamicClient.Resource(gvr).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	unstructuredList, err := clients.Dynamic.Resource(gvr).Namespace(namespace).List(ctx, metav1.ListOptions{})
 	if err != nil {
-		fmt.Println("Failed to get resources:", err)
-		return nil
+		log.Println("Failed to get resources:", err)
+		return nil, Classify(cluster, resource, err)
 	}
 
 	// return objects as []unstructured.Unstructured
-	return unstructuredList.Items
+	return unstructuredList.Items, nil
 }
 
-func GetUniversalObjectPerNsAsString(cluster, configPath string, namespace string, group string, version string, resource string) []string {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second) // timeout wait cluster response
+func GetUniversalObjectPerNsAsString(ctx context.Context, cluster, configPath string, namespace string, group string, version string, resource string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, RequestTimeout()) // timeout wait cluster response
 	defer cancel()
-	config, err := clientcmd.BuildConfigFromFlags("", configPath)
-	if err != nil {
-		fmt.Println("Failed to build config from kubeconfig file in k8s.GetUniversalObjectPerNsAsString func:", cluster)
+	if IsOffline(configPath) {
+		objects, err := OfflineObjects(configPath, namespace, SnapshotResource(group, version, resource))
+		if err != nil {
+			return nil, Classify(cluster, resource, err)
+		}
+		var names []string
+		for _, obj := range objects {
+			names = append(names, obj.GetName())
+		}
+		return names, nil
 	}
-
-	dynamicClient, err := dynamic.NewForConfig(config)
+	clients, err := GetClients(cluster, configPath)
 	if err != nil {
-		fmt.Println("Failed to create client in k8s.GetUniversalObjectPerNsAsString func:", err)
-		return nil
+		log.Println("Failed to create client in k8s.GetUniversalObjectPerNsAsString func:", err)
+		return nil, Classify(cluster, resource, err)
 	}
 
+	// only names are needed, so metadata is requested instead of full objects
 	gvr := schema.GroupVersionResource{Group: group, Version: version, Resource: resource}
-	unstructuredList, err := dynamicClient.Resource(gvr).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	list, err := clients.Metadata.Resource(gvr).Namespace(namespace).List(ctx, metav1.ListOptions{})
 	if err != nil {
-		fmt.Println("Failed to get resources in k8s.GetUniversalObjectPerNsAsString func):", err)
-		return nil
+		log.Println("Failed to get resources in k8s.GetUniversalObjectPerNsAsString func):", err)
+		return nil, Classify(cluster, resource, err)
 	}
 
-	// convert []unstructured.Unstructured to []string return objects as strings
+	// convert list to []string return objects as strings
 	var universalObjectNames []string
-	for _, unstructuredObj := range unstructuredList.Items {
-		universalObjectNames = append(universalObjectNames, unstructuredObj.GetName())
+	for _, obj := range list.Items {
+		universalObjectNames = append(universalObjectNames, obj.GetName())
 	}
-	return universalObjectNames
+	return universalObjectNames, nil
 }
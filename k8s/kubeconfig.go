@@ -0,0 +1,150 @@
+package k8s
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// kubeconfigs uploaded by users ("External" mode) are never written to disk,
+// they live here under pseudo paths like "memory:<random id>"
+const memoryConfigPrefix = "memory:"
+
+var memoryConfigs = struct {
+	sync.RWMutex
+	configs map[string]*clientcmdapi.Config
+}{configs: make(map[string]*clientcmdapi.Config)}
+
+// RegisterMemoryConfig validates uploaded kubeconfig and keeps it in memory,
+// returned pseudo path can be used everywhere instead of path to kubeconfig file.
+func RegisterMemoryConfig(data []byte) (string, error) {
+	config, err := clientcmd.Load(data)
+	if err != nil {
+		return "", fmt.Errorf("invalid kubeconfig: %v", err)
+	}
+	if len(config.Contexts) == 0 {
+		return "", fmt.Errorf("invalid kubeconfig: no contexts found")
+	}
+	for name, context := range config.Contexts {
+		if _, ok := config.Clusters[context.Cluster]; !ok {
+			return "", fmt.Errorf("invalid kubeconfig: cluster %q of context %q not found", context.Cluster, name)
+		}
+	}
+	if err := checkUploadedCredentials(config); err != nil {
+		return "", fmt.Errorf("invalid kubeconfig: %v", err)
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	path := memoryConfigPrefix + hex.EncodeToString(b)
+
+	memoryConfigs.Lock()
+	memoryConfigs.configs[path] = config
+	memoryConfigs.Unlock()
+	return path, nil
+}
+
+// checkUploadedCredentials rejects credentials which make the server run commands
+// (exec plugins, auth providers) or read its own files (tokenFile, client-key...)
+// and send them to the cluster of the kubeconfig, only inline data is accepted
+func checkUploadedCredentials(config *clientcmdapi.Config) error {
+	for name, user := range config.AuthInfos {
+		if user.Exec != nil {
+			return fmt.Errorf("user %q: exec plugins are not allowed, use token or client-certificate-data", name)
+		}
+		if user.AuthProvider != nil {
+			return fmt.Errorf("user %q: auth-provider is not allowed, use token or client-certificate-data", name)
+		}
+		for _, file := range []struct{ field, path string }{
+			{"tokenFile", user.TokenFile},
+			{"client-certificate", user.ClientCertificate},
+			{"client-key", user.ClientKey},
+		} {
+			if file.path != "" {
+				return fmt.Errorf("user %q: %s is not allowed, use inline data (token, client-certificate-data, client-key-data)", name, file.field)
+			}
+		}
+	}
+	for name, cluster := range config.Clusters {
+		if cluster.CertificateAuthority != "" {
+			return fmt.Errorf("cluster %q: certificate-authority is not allowed, use certificate-authority-data", name)
+		}
+	}
+	return nil
+}
+
+// ForgetMemoryConfig wipes uploaded kubeconfig from memory
+func ForgetMemoryConfig(path string) {
+	memoryConfigs.Lock()
+	delete(memoryConfigs.configs, path)
+	memoryConfigs.Unlock()
+	forgetClients(path)
+}
+
+// loadKubeconfig reads kubeconfig from file or from uploaded ones, result is a
+// copy so callers are free to change CurrentContext
+func loadKubeconfig(configPath string) (*clientcmdapi.Config, error) {
+	if strings.HasPrefix(configPath, memoryConfigPrefix) {
+		memoryConfigs.RLock()
+		config, ok := memoryConfigs.configs[configPath]
+		memoryConfigs.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("uploaded kubeconfig is expired or removed, please upload it again")
+		}
+		return config.DeepCopy(), nil
+	}
+	return clientcmd.LoadFromFile(configPath)
+}
+
+// SetClusterConfigExternal returns context_name:pseudo_path for uploaded kubeconfigs,
+// the same way SetClusterConfigHome does for ~/.kube/config. Uploaded kubeconfigs
+// often have the same context names ("default"), such contexts of the second
+// kubeconfig are renamed to "<name>-2".
+func SetClusterConfigExternal(configPaths ...string) (map[string]string, error) {
+	clusters := make(map[string]string)
+	for i, configPath := range configPaths {
+		memoryConfigs.Lock()
+		config, ok := memoryConfigs.configs[configPath]
+		if !ok {
+			memoryConfigs.Unlock()
+			return nil, fmt.Errorf("uploaded kubeconfig is expired or removed, please upload it again")
+		}
+		for _, contextName := range sortedContexts(config) {
+			name := contextName
+			for n := i + 1; clusters[name] != ""; n++ {
+				name = fmt.Sprintf("%s-%d", contextName, n)
+			}
+			if name != contextName {
+				renameContext(config, contextName, name)
+			}
+			clusters[name] = configPath
+		}
+		memoryConfigs.Unlock()
+	}
+	return clusters, nil
+}
+
+func sortedContexts(config *clientcmdapi.Config) []string {
+	names := make([]string, 0, len(config.Contexts))
+	for name := range config.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func renameContext(config *clientcmdapi.Config, from, to string) {
+	config.Contexts[to] = config.Contexts[from]
+	delete(config.Contexts, from)
+	if config.CurrentContext == from {
+		config.CurrentContext = to
+	}
+}
@@ -0,0 +1,94 @@
+package k8s
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestCheckUploadedCredentials(t *testing.T) {
+	tests := []struct {
+		name    string
+		user    clientcmdapi.AuthInfo
+		cluster clientcmdapi.Cluster
+		wantErr string
+	}{
+		{name: "inline token", user: clientcmdapi.AuthInfo{Token: "secret"}, cluster: clientcmdapi.Cluster{CertificateAuthorityData: []byte("ca")}},
+		{name: "inline certificate", user: clientcmdapi.AuthInfo{ClientCertificateData: []byte("cert"), ClientKeyData: []byte("key")}},
+		{name: "exec plugin", user: clientcmdapi.AuthInfo{Exec: &clientcmdapi.ExecConfig{Command: "sh"}}, wantErr: "exec plugins"},
+		{name: "auth provider", user: clientcmdapi.AuthInfo{AuthProvider: &clientcmdapi.AuthProviderConfig{Name: "gcp"}}, wantErr: "auth-provider"},
+		{name: "token file", user: clientcmdapi.AuthInfo{TokenFile: "/var/run/secrets/kubernetes.io/serviceaccount/token"}, wantErr: "tokenFile"},
+		{name: "client certificate file", user: clientcmdapi.AuthInfo{ClientCertificate: "/etc/ssl/cert.pem"}, wantErr: "client-certificate"},
+		{name: "client key file", user: clientcmdapi.AuthInfo{ClientKey: "/etc/ssl/key.pem"}, wantErr: "client-key"},
+		{name: "certificate authority file", cluster: clientcmdapi.Cluster{CertificateAuthority: "/etc/ssl/ca.pem"}, wantErr: "certificate-authority"},
+	}
+	for _, tt := range tests {
+		user, cluster := tt.user, tt.cluster
+		config := &clientcmdapi.Config{
+			AuthInfos: map[string]*clientcmdapi.AuthInfo{"admin": &user},
+			Clusters:  map[string]*clientcmdapi.Cluster{"prod": &cluster},
+		}
+		err := checkUploadedCredentials(config)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s: checkUploadedCredentials() error = %v", tt.name, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%s: checkUploadedCredentials() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func uploadedKubeconfig(t *testing.T, contexts ...string) string {
+	t.Helper()
+	var b strings.Builder
+	b.WriteString("apiVersion: v1\nkind: Config\nclusters:\n- name: cluster\n  cluster:\n    server: https://127.0.0.1:6443\nusers:\n- name: user\n  user:\n    token: secret\ncontexts:\n")
+	for _, name := range contexts {
+		fmt.Fprintf(&b, "- name: %s\n  context:\n    cluster: cluster\n    user: user\n", name)
+	}
+	fmt.Fprintf(&b, "current-context: %s\n", contexts[0])
+	path, err := RegisterMemoryConfig([]byte(b.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ForgetMemoryConfig(path) })
+	return path
+}
+
+func TestSetClusterConfigExternalRenamesDuplicates(t *testing.T) {
+	first := uploadedKubeconfig(t, "default", "stage")
+	second := uploadedKubeconfig(t, "default", "prod")
+	third := uploadedKubeconfig(t, "default")
+	want := map[string]string{
+		"default":   first,
+		"stage":     first,
+		"default-2": second,
+		"prod":      second,
+		"default-3": third,
+	}
+	// the second call sees already renamed contexts and returns the same names
+	for call := 1; call <= 2; call++ {
+		clusters, err := SetClusterConfigExternal(first, second, third)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(clusters, want) {
+			t.Errorf("call %d: SetClusterConfigExternal() = %v, want %v", call, clusters, want)
+		}
+	}
+
+	config, err := loadKubeconfig(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := config.Contexts["default-2"]; !ok || config.Contexts["default"] != nil || config.CurrentContext != "default-2" {
+		t.Errorf("renamed kubeconfig contexts = %v, current %s", config.Contexts, config.CurrentContext)
+	}
+
+	ForgetMemoryConfig(third)
+	if _, err := SetClusterConfigExternal(first, third); err == nil {
+		t.Error("SetClusterConfigExternal() of forgotten kubeconfig error = nil")
+	}
+}
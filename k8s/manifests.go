@@ -0,0 +1,335 @@
+package k8s
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+// Manifests are the desired state from git (plain YAML/JSON or kustomize/helm
+// template output) compared with a live cluster. All *.yaml, *.yml and *.json
+// files of the directory are read, multi-document files and List objects are
+// supported. Manifests are used everywhere instead of kubeconfig under pseudo
+// path "manifests:<path>". Objects without namespace (kubectl apply -n ...) are
+// in every namespace.
+const manifestsConfigPrefix = "manifests:"
+
+// Manifests are objects of a manifest directory indexed by group/resource and namespace
+type Manifests struct {
+	path    string
+	version string
+	// "apps/deployments" -> namespace -> objects, version of the api is not
+	// compared: the cluster returns objects in the requested version anyway
+	objects map[string]map[string][]unstructured.Unstructured
+}
+
+var manifests = struct {
+	sync.Mutex
+	dirs   map[string]string
+	opened map[string]*Manifests
+}{dirs: make(map[string]string), opened: make(map[string]*Manifests)}
+
+// some kinds are not plural of the lowercase kind name
+var irregularResources = map[string]string{
+	"endpoints": "endpoints",
+}
+
+// SetManifestDirs sets name -> directory of manifests shown in the cluster picker
+func SetManifestDirs(dirs map[string]string) {
+	if dirs == nil {
+		dirs = make(map[string]string)
+	}
+	manifests.Lock()
+	manifests.dirs = dirs
+	manifests.Unlock()
+}
+
+// ManifestsConfigPath returns pseudo path of the manifest directory used instead of kubeconfig
+func ManifestsConfigPath(path string) string {
+	return manifestsConfigPrefix + path
+}
+
+// IsManifests is true when the pseudo path points to manifests instead of kubeconfig
+func IsManifests(configPath string) bool {
+	return strings.HasPrefix(configPath, manifestsConfigPrefix)
+}
+
+// SetClusterConfigManifests returns "manifests:name":pseudo_path for manifest
+// directories from config, they are shown in the cluster picker next to live clusters
+func SetClusterConfigManifests() map[string]string {
+	manifests.Lock()
+	defer manifests.Unlock()
+	clusterConfigPaths := make(map[string]string)
+	for name, dir := range manifests.dirs {
+		clusterConfigPaths["manifests:"+name] = ManifestsConfigPath(dir)
+	}
+	return clusterConfigPaths
+}
+
+// OpenManifests reads manifests by pseudo path or by path of directory (or one
+// file), they are read again when any file is changed
+func OpenManifests(configPath string) (*Manifests, error) {
+	p := strings.TrimPrefix(configPath, manifestsConfigPrefix)
+	files, version, err := manifestFiles(p)
+	if err == nil && len(files) == 0 {
+		err = fmt.Errorf("manifests %s: %w", p, errNoManifests)
+	}
+	if err != nil {
+		return nil, kubeconfigError{err}
+	}
+
+	manifests.Lock()
+	defer manifests.Unlock()
+	if m, ok := manifests.opened[p]; ok && m.version == version {
+		return m, nil
+	}
+	m := &Manifests{path: p, version: version, objects: make(map[string]map[string][]unstructured.Unstructured)}
+	for _, file := range files {
+		objects, err := readManifestFile(file)
+		if err != nil {
+			return nil, kubeconfigError{fmt.Errorf("manifests %s: %v", file, err)}
+		}
+		for _, obj := range objects {
+			m.add(obj)
+		}
+	}
+	manifests.opened[p] = m
+	return m, nil
+}
+
+// manifestFiles returns manifest files of the directory and their version
+// (changed every time any file is changed), hidden directories like .git are skipped
+func manifestFiles(root string) ([]string, string, error) {
+	var files []string
+	var version strings.Builder
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".yaml", ".yml", ".json":
+		default:
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, path)
+		fmt.Fprint(&version, path, "/", info.ModTime().UnixNano(), "/", info.Size(), ";")
+		return nil
+	})
+	return files, version.String(), err
+}
+
+// readManifestFile returns objects of all documents of the file
+func readManifestFile(file string) ([]unstructured.Unstructured, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return ParseManifests(data)
+}
+
+// ParseManifests returns objects of multi-document YAML or JSON (manifests of
+// helm release, kustomize output), documents which are not kubernetes objects
+// (helm values, kustomization.yaml) are skipped
+func ParseManifests(data []byte) ([]unstructured.Unstructured, error) {
+	var objects []unstructured.Unstructured
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(data)))
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		jsonDoc, err := yaml.YAMLToJSON(doc)
+		if err != nil {
+			return nil, err
+		}
+		var header struct {
+			APIVersion string          `json:"apiVersion"`
+			Kind       string          `json:"kind"`
+			Items      json.RawMessage `json:"items"`
+		}
+		if err := json.Unmarshal(jsonDoc, &header); err != nil || header.APIVersion == "" || header.Kind == "" {
+			continue // empty document or not an object
+		}
+		if strings.HasPrefix(header.APIVersion, "kustomize.config.k8s.io/") {
+			log.Println("Kustomization in manifests is skipped, use output of kustomize build")
+			continue
+		}
+		// objects are decoded the same way as cluster responses, so numbers are int64 on both sides
+		if header.Items != nil {
+			var list unstructured.UnstructuredList
+			if err := list.UnmarshalJSON(jsonDoc); err != nil {
+				return nil, err
+			}
+			objects = append(objects, list.Items...)
+			continue
+		}
+		var obj unstructured.Unstructured
+		if err := obj.UnmarshalJSON(jsonDoc); err != nil {
+			return nil, err
+		}
+		objects = append(objects, obj)
+	}
+}
+
+func (m *Manifests) add(obj unstructured.Unstructured) {
+	gvk := obj.GroupVersionKind()
+	key := gvk.Group + "/" + ResourceOfKind(gvk.Kind)
+	if m.objects[key] == nil {
+		m.objects[key] = make(map[string][]unstructured.Unstructured)
+	}
+	m.objects[key][obj.GetNamespace()] = append(m.objects[key][obj.GetNamespace()], obj)
+}
+
+// ResourceOfKind returns resource of the kind the same way as kubectl does for most kinds
+func ResourceOfKind(kind string) string {
+	lower := strings.ToLower(kind)
+	if resource, ok := irregularResources[lower]; ok {
+		return resource
+	}
+	switch {
+	case strings.HasSuffix(lower, "s"), strings.HasSuffix(lower, "x"), strings.HasSuffix(lower, "ch"), strings.HasSuffix(lower, "sh"):
+		return lower + "es"
+	case strings.HasSuffix(lower, "y") && len(lower) > 1 && !strings.ContainsRune("aeiou", rune(lower[len(lower)-2])):
+		return lower[:len(lower)-1] + "ies"
+	}
+	return lower + "s"
+}
+
+// manifestsKey returns "group/resource" of resource like "apps/v1/deployments"
+func manifestsKey(resource string) (string, bool) {
+	parts := strings.Split(resource, "/")
+	switch {
+	case strings.HasPrefix(resource, "helm/"): // helm values and releases
+		return "", false
+	case len(parts) == 2:
+		return "/" + parts[1], true
+	case len(parts) == 3:
+		return parts[0] + "/" + parts[2], true
+	}
+	return "", false
+}
+
+// Namespaces returns namespaces of the objects, "default" when no object has namespace
+func (m *Manifests) Namespaces() []string {
+	set := make(map[string]bool)
+	for _, byNamespace := range m.objects {
+		for namespace := range byNamespace {
+			if namespace != "" {
+				set[namespace] = true
+			}
+		}
+	}
+	if len(set) == 0 {
+		return []string{"default"}
+	}
+	namespaces := make([]string, 0, len(set))
+	for namespace := range set {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// KubernetesVersion is empty, manifests are not bound to a version
+func (m *Manifests) KubernetesVersion() string {
+	return ""
+}
+
+// Objects returns objects of the resource in the namespace and objects without namespace
+func (m *Manifests) Objects(namespace, resource string) ([]unstructured.Unstructured, error) {
+	key, ok := manifestsKey(resource)
+	if !ok {
+		return nil, m.unsupported(resource)
+	}
+	byNamespace := m.objects[key]
+	objects := make([]unstructured.Unstructured, 0, len(byNamespace[namespace])+len(byNamespace[""]))
+	objects = append(objects, byNamespace[namespace]...)
+	if namespace != "" {
+		objects = append(objects, byNamespace[""]...)
+	}
+	return objects, nil
+}
+
+// allObjects returns objects of the resource in all namespaces, objects without
+// namespace (cluster scoped ones too) are returned once, not for every namespace
+func (m *Manifests) allObjects(resource string) ([]unstructured.Unstructured, error) {
+	key, ok := manifestsKey(resource)
+	if !ok {
+		return nil, m.unsupported(resource)
+	}
+	byNamespace := m.objects[key]
+	namespaces := make([]string, 0, len(byNamespace))
+	for namespace := range byNamespace {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	var objects []unstructured.Unstructured
+	for _, namespace := range namespaces {
+		objects = append(objects, byNamespace[namespace]...)
+	}
+	return objects, nil
+}
+
+// Count returns number of objects of the resource in all namespaces
+func (m *Manifests) Count(resource string) (int, error) {
+	key, ok := manifestsKey(resource)
+	if !ok {
+		return 0, m.unsupported(resource)
+	}
+	count := 0
+	for _, objects := range m.objects[key] {
+		count += len(objects)
+	}
+	return count, nil
+}
+
+// Resources returns resources of the objects, the version is taken from the first object
+func (m *Manifests) Resources() []APIResource {
+	var resources []APIResource
+	for _, byNamespace := range m.objects {
+		for _, objects := range byNamespace {
+			if len(objects) == 0 {
+				continue
+			}
+			gvk := objects[0].GroupVersionKind()
+			resources = append(resources, APIResource{Group: gvk.Group, Version: gvk.Version, Resource: ResourceOfKind(gvk.Kind), Kind: gvk.Kind})
+			break
+		}
+	}
+	sortResources(resources)
+	return resources
+}
+
+func (m *Manifests) unsupported(what string) error {
+	return offlineError{ReasonNotInManifests, what + " are not in manifests"}
+}
+
+// errNoManifests is returned when the path has no manifest files at all
+var errNoManifests = errors.New("no *.yaml, *.yml or *.json files found")
@@ -0,0 +1,146 @@
+package k8s
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestParseManifests(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    []string // kind/name of the objects
+		wantErr bool
+	}{
+		{
+			name: "multi-document yaml",
+			data: "---\napiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: api\n---\n\n---\napiVersion: v1\nkind: Service\nmetadata:\n  name: api\n",
+			want: []string{"Deployment/api", "Service/api"},
+		},
+		{
+			name: "json",
+			data: `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "settings"}}`,
+			want: []string{"ConfigMap/settings"},
+		},
+		{
+			name: "list items",
+			data: "apiVersion: v1\nkind: List\nitems:\n- apiVersion: v1\n  kind: Secret\n  metadata:\n    name: a\n- apiVersion: v1\n  kind: Secret\n  metadata:\n    name: b\n",
+			want: []string{"Secret/a", "Secret/b"},
+		},
+		{
+			name: "values and kustomization are skipped",
+			data: "replicas: 2\nimage: app:1\n---\napiVersion: kustomize.config.k8s.io/v1beta1\nkind: Kustomization\nresources:\n- deployment.yaml\n---\n# only a comment\n",
+		},
+		{
+			name:    "invalid yaml",
+			data:    "apiVersion: v1\nkind: [ConfigMap\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		objects, err := ParseManifests([]byte(tt.data))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: ParseManifests() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		var got []string
+		for _, obj := range objects {
+			got = append(got, obj.GetKind()+"/"+obj.GetName())
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: ParseManifests() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseManifestsNumbers(t *testing.T) {
+	objects, err := ParseManifests([]byte("apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: api\nspec:\n  replicas: 2\n"))
+	if err != nil || len(objects) != 1 {
+		t.Fatalf("ParseManifests() = %v, %v", objects, err)
+	}
+	// the same type as in objects read from the cluster
+	if replicas := objects[0].Object["spec"].(map[string]interface{})["replicas"]; replicas != int64(2) {
+		t.Errorf("replicas = %#v, want int64(2)", replicas)
+	}
+}
+
+func TestResourceOfKind(t *testing.T) {
+	tests := map[string]string{
+		"Deployment":    "deployments",
+		"Ingress":       "ingresses",
+		"NetworkPolicy": "networkpolicies",
+		"Gateway":       "gateways",
+		"Endpoints":     "endpoints",
+		"IngressClass":  "ingressclasses",
+		"Mesh":          "meshes",
+		"Sandbox":       "sandboxes",
+		"Batch":         "batches",
+	}
+	for kind, want := range tests {
+		if got := ResourceOfKind(kind); got != want {
+			t.Errorf("ResourceOfKind(%s) = %s, want %s", kind, got, want)
+		}
+	}
+}
+
+func TestManifestsObjects(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"payments.yaml": "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: api\n  namespace: payments\n",
+		"common.yaml":   "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: exporter\n",
+		"README.md":     "not a manifest",
+		".git/x.yaml":   "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: hidden\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := OpenManifests(ManifestsConfigPath(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := func(objects []unstructured.Unstructured, err error) []string {
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, obj := range objects {
+			names = append(names, obj.GetName())
+		}
+		return names
+	}
+
+	const deployments = "apps/v1/deployments"
+	tests := []struct {
+		name string
+		got  []string
+		want []string
+	}{
+		{"namespace", names(m.Objects("payments", deployments)), []string{"api", "exporter"}},
+		{"other namespace", names(m.Objects("billing", deployments)), []string{"exporter"}},
+		{"all namespaces", names(m.allObjects(deployments)), []string{"exporter", "api"}},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s: objects = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+	if got := m.Namespaces(); !reflect.DeepEqual(got, []string{"payments"}) {
+		t.Errorf("Namespaces() = %v", got)
+	}
+	if _, err := m.Objects("payments", "helm/values"); ReasonOf(err) != ReasonNotInManifests {
+		t.Errorf("Objects(helm/values) error = %v, want %s", err, ReasonNotInManifests)
+	}
+	if _, err := OpenManifests(ManifestsConfigPath(t.TempDir())); ReasonOf(err) != ReasonKubeconfig {
+		t.Errorf("OpenManifests(empty directory) error = %v, want %s", err, ReasonKubeconfig)
+	}
+}
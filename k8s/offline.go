@@ -0,0 +1,64 @@
+package k8s
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// offlineSource is a side of the comparison read without cluster API: snapshot
+// ("snapshot:<path>") or directory of manifests ("manifests:<path>"). Fetchers
+// check IsOffline first and read the source instead of the cluster.
+type offlineSource interface {
+	Namespaces() []string
+	KubernetesVersion() string
+	// Objects and Count take resource like "apps/v1/deployments" (see SnapshotResource)
+	Objects(namespace, resource string) ([]unstructured.Unstructured, error)
+	// allObjects returns objects of the resource in all namespaces, every object once
+	allObjects(resource string) ([]unstructured.Unstructured, error)
+	Count(resource string) (int, error)
+	// Resources are resources the source has objects of, see NamespacedResources
+	Resources() []APIResource
+	// unsupported is the error for data the source never has (nodes, pods)
+	unsupported(what string) error
+}
+
+// offlineError is returned for objects which are not in the offline source
+type offlineError struct {
+	reason Reason
+	msg    string
+}
+
+func (e offlineError) Error() string { return e.msg }
+
+// IsOffline is true when the pseudo path points to a snapshot or to manifests instead of kubeconfig
+func IsOffline(configPath string) bool {
+	return IsSnapshot(configPath) || IsManifests(configPath)
+}
+
+func openOffline(configPath string) (offlineSource, error) {
+	if IsManifests(configPath) {
+		return OpenManifests(configPath)
+	}
+	return OpenSnapshot(configPath)
+}
+
+// OfflineObjects returns objects of the resource from snapshot or manifests,
+// empty namespace is all namespaces of the source
+func OfflineObjects(configPath, namespace, resource string) ([]unstructured.Unstructured, error) {
+	source, err := openOffline(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if namespace != "" {
+		return source.Objects(namespace, resource)
+	}
+	return source.allObjects(resource)
+}
+
+// OfflineUnsupported returns error for data which is never in snapshots or manifests
+func OfflineUnsupported(configPath, what string) error {
+	source, err := openOffline(configPath)
+	if err != nil {
+		return err
+	}
+	return source.unsupported(what)
+}
@@ -0,0 +1,70 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Plan runs API calls needed by one page concurrently. All calls share the
+// request context, so closing the browser tab cancels the work, and no more
+// than Parallelism calls run at the same time.
+type Plan struct {
+	ctx context.Context
+	sem chan struct{}
+	wg  sync.WaitGroup
+
+	mu   sync.Mutex
+	errs []CallError
+}
+
+// CallError is an error of one call of the plan
+type CallError struct {
+	Call string
+	Err  error
+}
+
+func (e CallError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Call, e.Err)
+}
+
+// NewPlan returns plan bound to the request context
+func NewPlan(ctx context.Context) *Plan {
+	return &Plan{ctx: ctx, sem: make(chan struct{}, Parallelism())}
+}
+
+// Go schedules the call, f gets the request context and must respect it
+func (p *Plan) Go(call string, f func(ctx context.Context) error) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		select {
+		case p.sem <- struct{}{}:
+			defer func() { <-p.sem }()
+		case <-p.ctx.Done():
+			p.fail(call, p.ctx.Err())
+			return
+		}
+		if err := p.ctx.Err(); err != nil {
+			p.fail(call, err)
+			return
+		}
+		if err := f(p.ctx); err != nil {
+			p.fail(call, err)
+		}
+	}()
+}
+
+// Wait waits for all calls and returns their errors in no particular order
+func (p *Plan) Wait() []CallError {
+	p.wg.Wait()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.errs
+}
+
+func (p *Plan) fail(call string, err error) {
+	p.mu.Lock()
+	p.errs = append(p.errs, CallError{Call: call, Err: err})
+	p.mu.Unlock()
+}
@@ -0,0 +1,464 @@
+package k8s
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Snapshot keeps objects of a cluster read at some moment, so the cluster can be
+// compared after an incident or when it is not reachable anymore. Snapshot is a
+// directory or .tar.gz with the same content:
+//
+//	manifest.json                                  SnapshotManifest
+//	objects/<namespace>/<resource>.json            objects as JSON array, resource is "apps_v1_deployments"
+//
+// Snapshot is used everywhere instead of kubeconfig under pseudo path
+// "snapshot:<path>", fetchers read the snapshot instead of cluster API then.
+const snapshotConfigPrefix = "snapshot:"
+
+// SnapshotFormatVersion is written to every manifest, snapshots of other versions are not read
+const SnapshotFormatVersion = 1
+
+// SnapshotHelmValues is the resource of helm release values in snapshots
+const SnapshotHelmValues = "helm/values"
+
+// SnapshotHelmReleases is the resource of helm releases (chart, status, values, manifest) in snapshots
+const SnapshotHelmReleases = "helm/releases"
+
+const snapshotManifestFile = "manifest.json"
+
+// SnapshotManifest describes what is captured in the snapshot
+type SnapshotManifest struct {
+	FormatVersion     int       `json:"formatVersion"`
+	Cluster           string    `json:"cluster"`
+	KubernetesVersion string    `json:"kubernetesVersion,omitempty"`
+	CapturedAt        time.Time `json:"capturedAt"`
+	Namespaces        []string  `json:"namespaces"`
+	// Resources are captured resources like "apps/v1/deployments", objects of
+	// a resource which could not be read in some namespace are not in the snapshot
+	Resources []string `json:"resources"`
+	// NotInstalled are resources (CRDs) not served by the cluster when captured
+	NotInstalled []string `json:"notInstalled,omitempty"`
+	// SecretFingerprints is the scheme of Secret value fingerprints, "sha256" or
+	// "hmac-sha256:<key id>", they are comparable only with the same scheme
+	SecretFingerprints string `json:"secretFingerprints,omitempty"`
+}
+
+// Snapshot is an opened snapshot directory or tarball
+type Snapshot struct {
+	Manifest SnapshotManifest
+	path     string
+	files    map[string][]byte // content of tarball, nil for directory
+	version  string
+}
+
+var snapshots = struct {
+	sync.Mutex
+	dir    string
+	opened map[string]*Snapshot
+}{dir: "./snapshots", opened: make(map[string]*Snapshot)}
+
+// SetSnapshotDir sets directory with snapshots shown in the cluster picker
+func SetSnapshotDir(dir string) {
+	if dir == "" {
+		return
+	}
+	snapshots.Lock()
+	snapshots.dir = dir
+	snapshots.Unlock()
+}
+
+// SnapshotDir returns directory with snapshots shown in the cluster picker
+func SnapshotDir() string {
+	snapshots.Lock()
+	defer snapshots.Unlock()
+	return snapshots.dir
+}
+
+// SnapshotConfigPath returns pseudo path of the snapshot used instead of kubeconfig
+func SnapshotConfigPath(path string) string {
+	return snapshotConfigPrefix + path
+}
+
+// IsSnapshot is true when the pseudo path points to a snapshot instead of kubeconfig
+func IsSnapshot(configPath string) bool {
+	return strings.HasPrefix(configPath, snapshotConfigPrefix)
+}
+
+// SnapshotResource returns resource name used in snapshots, "apps/v1/deployments" or "v1/services"
+func SnapshotResource(group, version, resource string) string {
+	if group == "" {
+		return version + "/" + resource
+	}
+	return group + "/" + version + "/" + resource
+}
+
+// SetClusterConfigSnapshots returns "snapshot:name":pseudo_path for snapshots of the
+// snapshot directory, they are shown in the cluster picker next to live clusters
+func SetClusterConfigSnapshots() map[string]string {
+	clusterConfigPaths := make(map[string]string)
+	dir := SnapshotDir()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Println("Error reading snapshot directory:", err)
+		}
+		return clusterConfigPaths
+	}
+	for _, entry := range entries {
+		name, ok := snapshotName(dir, entry)
+		if ok {
+			clusterConfigPaths["snapshot:"+name] = SnapshotConfigPath(filepath.Join(dir, entry.Name()))
+		}
+	}
+	return clusterConfigPaths
+}
+
+func snapshotName(dir string, entry os.DirEntry) (string, bool) {
+	if entry.IsDir() {
+		_, err := os.Stat(filepath.Join(dir, entry.Name(), snapshotManifestFile))
+		return entry.Name(), err == nil
+	}
+	for _, ext := range []string{".tar.gz", ".tgz"} {
+		if strings.HasSuffix(entry.Name(), ext) {
+			return strings.TrimSuffix(entry.Name(), ext), true
+		}
+	}
+	return "", false
+}
+
+func isSnapshotTarball(path string) bool {
+	return strings.HasSuffix(path, ".tar.gz") || strings.HasSuffix(path, ".tgz")
+}
+
+// OpenSnapshot opens snapshot by pseudo path or by path of directory/tarball,
+// opened snapshots are reused until the files are changed
+func OpenSnapshot(configPath string) (*Snapshot, error) {
+	p := strings.TrimPrefix(configPath, snapshotConfigPrefix)
+	version, err := snapshotVersion(p)
+	if err != nil {
+		return nil, kubeconfigError{err}
+	}
+
+	snapshots.Lock()
+	defer snapshots.Unlock()
+	if s, ok := snapshots.opened[p]; ok && s.version == version {
+		return s, nil
+	}
+	s, err := openSnapshot(p)
+	if err != nil {
+		return nil, kubeconfigError{fmt.Errorf("snapshot %s: %v", p, err)}
+	}
+	s.version = version
+	snapshots.opened[p] = s
+	return s, nil
+}
+
+func snapshotVersion(p string) (string, error) {
+	if !isSnapshotTarball(p) {
+		p = filepath.Join(p, snapshotManifestFile)
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprint(info.ModTime().UnixNano(), "/", info.Size()), nil
+}
+
+func openSnapshot(p string) (*Snapshot, error) {
+	s := &Snapshot{path: p}
+	if isSnapshotTarball(p) {
+		files, err := readTarball(p)
+		if err != nil {
+			return nil, err
+		}
+		s.files = files
+	}
+	data, err := s.read(snapshotManifestFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.Manifest); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", snapshotManifestFile, err)
+	}
+	if s.Manifest.FormatVersion != SnapshotFormatVersion {
+		return nil, fmt.Errorf("unsupported snapshot format version %d", s.Manifest.FormatVersion)
+	}
+	return s, nil
+}
+
+func readTarball(p string) (map[string][]byte, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	files := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[path.Clean(header.Name)] = data
+	}
+}
+
+func (s *Snapshot) read(name string) ([]byte, error) {
+	if s.files == nil {
+		return os.ReadFile(filepath.Join(s.path, filepath.FromSlash(name)))
+	}
+	data, ok := s.files[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", name, os.ErrNotExist)
+	}
+	return data, nil
+}
+
+func snapshotObjectsFile(namespace, resource string) string {
+	return path.Join("objects", namespace, strings.ReplaceAll(resource, "/", "_")+".json")
+}
+
+// allObjects returns captured objects of the resource in all namespaces of the snapshot
+func (s *Snapshot) allObjects(resource string) ([]unstructured.Unstructured, error) {
+	var objects []unstructured.Unstructured
+	for _, namespace := range s.Manifest.Namespaces {
+		nsObjects, err := s.Objects(namespace, resource)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, nsObjects...)
+	}
+	return objects, nil
+}
+
+// Objects returns captured objects of the resource in the namespace
+func (s *Snapshot) Objects(namespace, resource string) ([]unstructured.Unstructured, error) {
+	if err := s.captured(resource); err != nil {
+		return nil, err
+	}
+	// only namespaces from the manifest are read, so the name can not point outside of the snapshot
+	if !containsString(s.Manifest.Namespaces, namespace) {
+		return nil, offlineError{ReasonNotCaptured, fmt.Sprintf("namespace %s is not in the snapshot", namespace)}
+	}
+	data, err := s.read(snapshotObjectsFile(namespace, resource))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, offlineError{ReasonNotCaptured, fmt.Sprintf("%s in namespace %s could not be read when the snapshot was captured", resource, namespace)}
+	}
+	if err != nil {
+		return nil, err
+	}
+	var objects []map[string]interface{}
+	if err := json.Unmarshal(data, &objects); err != nil {
+		return nil, fmt.Errorf("invalid snapshot file for %s in namespace %s: %v", resource, namespace, err)
+	}
+	result := make([]unstructured.Unstructured, 0, len(objects))
+	for _, obj := range objects {
+		result = append(result, unstructured.Unstructured{Object: obj})
+	}
+	return result, nil
+}
+
+// Count returns number of captured objects of the resource in all namespaces
+func (s *Snapshot) Count(resource string) (int, error) {
+	if err := s.captured(resource); err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, namespace := range s.Manifest.Namespaces {
+		objects, err := s.Objects(namespace, resource)
+		if err != nil {
+			var offlineErr offlineError
+			if errors.As(err, &offlineErr) {
+				continue
+			}
+			return 0, err
+		}
+		count += len(objects)
+	}
+	return count, nil
+}
+
+func (s *Snapshot) captured(resource string) error {
+	if containsString(s.Manifest.NotInstalled, resource) {
+		return offlineError{ReasonNotInstalled, fmt.Sprintf("%s was not installed when the snapshot was captured", resource)}
+	}
+	if !containsString(s.Manifest.Resources, resource) {
+		return offlineError{ReasonNotCaptured, fmt.Sprintf("%s is not in the snapshot", resource)}
+	}
+	return nil
+}
+
+// Resources returns captured kubernetes resources, helm data is not a resource
+func (s *Snapshot) Resources() []APIResource {
+	var resources []APIResource
+	for _, name := range s.Manifest.Resources {
+		if resource, ok := parseSnapshotResource(name); ok {
+			resources = append(resources, resource)
+		}
+	}
+	sortResources(resources)
+	return resources
+}
+
+// Namespaces returns captured namespaces
+func (s *Snapshot) Namespaces() []string {
+	return s.Manifest.Namespaces
+}
+
+// KubernetesVersion returns version of the cluster when captured
+func (s *Snapshot) KubernetesVersion() string {
+	return s.Manifest.KubernetesVersion
+}
+
+func (s *Snapshot) unsupported(what string) error {
+	return offlineError{ReasonNotCaptured, what + " are not captured in snapshots"}
+}
+
+// SnapshotWriter collects objects and writes the snapshot on Close
+type SnapshotWriter struct {
+	path     string
+	mu       sync.Mutex
+	manifest SnapshotManifest
+	files    map[string][]byte
+}
+
+// NewSnapshotWriter starts snapshot which is written to directory or to
+// tarball when path ends with .tar.gz or .tgz
+func NewSnapshotWriter(path string, manifest SnapshotManifest) *SnapshotWriter {
+	manifest.FormatVersion = SnapshotFormatVersion
+	if manifest.CapturedAt.IsZero() {
+		manifest.CapturedAt = time.Now().UTC()
+	}
+	return &SnapshotWriter{path: path, manifest: manifest, files: make(map[string][]byte)}
+}
+
+// Add keeps objects of the resource in the namespace, it is safe for concurrent use
+func (w *SnapshotWriter) Add(namespace, resource string, objects []unstructured.Unstructured) error {
+	items := make([]map[string]interface{}, 0, len(objects))
+	for _, obj := range objects {
+		items = append(items, obj.Object)
+	}
+	data, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.files[snapshotObjectsFile(namespace, resource)] = data
+	if !containsString(w.manifest.Resources, resource) {
+		w.manifest.Resources = append(w.manifest.Resources, resource)
+	}
+	return nil
+}
+
+// NotInstalled marks resource which is not served by the cluster
+func (w *SnapshotWriter) NotInstalled(resource string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !containsString(w.manifest.NotInstalled, resource) {
+		w.manifest.NotInstalled = append(w.manifest.NotInstalled, resource)
+	}
+}
+
+// Close writes the manifest and all added objects, it returns the written manifest
+func (w *SnapshotWriter) Close() (SnapshotManifest, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	sort.Strings(w.manifest.Namespaces)
+	sort.Strings(w.manifest.Resources)
+	sort.Strings(w.manifest.NotInstalled)
+	data, err := json.MarshalIndent(w.manifest, "", "  ")
+	if err != nil {
+		return w.manifest, err
+	}
+	w.files[snapshotManifestFile] = data
+
+	if isSnapshotTarball(w.path) {
+		return w.manifest, writeTarball(w.path, w.files)
+	}
+	for name, data := range w.files {
+		file := filepath.Join(w.path, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			return w.manifest, err
+		}
+		if err := os.WriteFile(file, data, 0o644); err != nil {
+			return w.manifest, err
+		}
+	}
+	return w.manifest, nil
+}
+
+func writeTarball(p string, files map[string][]byte) error {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, name := range names {
+		header := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(files[name])), ModTime: time.Now()}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write(files[name]); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	if dir := filepath.Dir(p); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(p, buf.Bytes(), 0o644)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
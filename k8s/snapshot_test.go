@@ -0,0 +1,123 @@
+package k8s
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func deployment(namespace, name string, replicas int64) unstructured.Unstructured {
+	return unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": name, "namespace": namespace},
+		"spec":       map[string]interface{}{"replicas": replicas},
+	}}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	const (
+		deployments = "apps/v1/deployments"
+		canaries    = "flagger.app/v1beta1/canaries"
+		services    = "v1/services"
+	)
+	capturedAt := time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC)
+	for _, name := range []string{"prod", "prod.tar.gz"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			writer := NewSnapshotWriter(path, SnapshotManifest{
+				Cluster:            "prod",
+				KubernetesVersion:  "v1.27.3",
+				CapturedAt:         capturedAt,
+				Namespaces:         []string{"payments", "billing"},
+				SecretFingerprints: "sha256",
+			})
+			objects := []unstructured.Unstructured{deployment("payments", "api", 2), deployment("payments", "worker", 1)}
+			if err := writer.Add("payments", deployments, objects); err != nil {
+				t.Fatal(err)
+			}
+			if err := writer.Add("billing", deployments, nil); err != nil {
+				t.Fatal(err)
+			}
+			writer.NotInstalled(canaries)
+			written, err := writer.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			snapshot, err := OpenSnapshot(SnapshotConfigPath(path))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := SnapshotManifest{
+				FormatVersion:      SnapshotFormatVersion,
+				Cluster:            "prod",
+				KubernetesVersion:  "v1.27.3",
+				CapturedAt:         capturedAt,
+				Namespaces:         []string{"billing", "payments"},
+				Resources:          []string{deployments},
+				NotInstalled:       []string{canaries},
+				SecretFingerprints: "sha256",
+			}
+			if !reflect.DeepEqual(snapshot.Manifest, want) || !reflect.DeepEqual(written, want) {
+				t.Errorf("manifest = %+v, written %+v, want %+v", snapshot.Manifest, written, want)
+			}
+
+			read, err := snapshot.Objects("payments", deployments)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(read) != 2 || read[0].GetName() != "api" || read[1].GetName() != "worker" {
+				t.Errorf("Objects() = %v", read)
+			}
+			// numbers are float64 after JSON
+			if replicas, _, _ := unstructured.NestedFloat64(read[0].Object, "spec", "replicas"); replicas != 2 {
+				t.Errorf("replicas = %v, want 2", replicas)
+			}
+			if count, err := snapshot.Count(deployments); err != nil || count != 2 {
+				t.Errorf("Count() = %d, %v, want 2", count, err)
+			}
+			all, err := OfflineObjects(SnapshotConfigPath(path), "", deployments)
+			if err != nil || len(all) != 2 {
+				t.Errorf("OfflineObjects(all namespaces) = %d objects, %v, want 2", len(all), err)
+			}
+			if got := snapshot.Resources(); !reflect.DeepEqual(got, []APIResource{{Group: "apps", Version: "v1", Resource: "deployments"}}) {
+				t.Errorf("Resources() = %v", got)
+			}
+
+			for _, tt := range []struct {
+				namespace, resource string
+				want                Reason
+			}{
+				{"payments", canaries, ReasonNotInstalled},
+				{"payments", services, ReasonNotCaptured},
+				{"orders", deployments, ReasonNotCaptured},
+				{"../../etc", deployments, ReasonNotCaptured},
+			} {
+				if _, err := snapshot.Objects(tt.namespace, tt.resource); ReasonOf(err) != tt.want {
+					t.Errorf("Objects(%s, %s) error = %v, want %s", tt.namespace, tt.resource, err, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestOpenSnapshotErrors(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := OpenSnapshot(SnapshotConfigPath(filepath.Join(dir, "missing"))); ReasonOf(err) != ReasonKubeconfig {
+		t.Errorf("OpenSnapshot(missing) error = %v, want %s", err, ReasonKubeconfig)
+	}
+
+	path := filepath.Join(dir, "future")
+	writer := NewSnapshotWriter(path, SnapshotManifest{Cluster: "prod"})
+	writer.manifest.FormatVersion = SnapshotFormatVersion + 1
+	if _, err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenSnapshot(SnapshotConfigPath(path)); err == nil {
+		t.Error("OpenSnapshot() of unsupported format version error = nil")
+	}
+}
@@ -1,14 +1,22 @@
 package main
 
 import (
+	"compareapp/cli"
+	"compareapp/diff"
 	"compareapp/handlers"
+	"compareapp/k8s"
+	"compareapp/state"
 	"context"
+	"crypto/subtle"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/sessions"
@@ -24,6 +32,7 @@ var (
 	redirectURL     string
 	gitlabTokenTime int
 	gitAllowedGroup string
+	apiToken        string
 	store           = sessions.NewCookieStore([]byte("90a541ecfa8ec6629c9")) // Replace with your secret
 )
 
@@ -37,6 +46,27 @@ type Config struct {
 	GitlabCallBackUrl  string `json:"callback_url"`
 	GitlabTokenLife    int    `json:"max_age_session_token"`
 	GitlabAllowedGroup string `json:"auth_group_name_allowed"`
+	CompareSessionTTL  int    `json:"compare_session_ttl"`
+	APIToken           string `json:"api_token"`
+	// kubernetes api clients settings, zero values keep defaults (50, 100, 5 seconds, 8)
+	KubeQPS         float32 `json:"kube_qps"`
+	KubeBurst       int     `json:"kube_burst"`
+	KubeTimeout     int     `json:"kube_timeout"`
+	KubeParallelism int     `json:"kube_parallelism"`
+	// namespace of the first cluster -> namespace of the second one
+	NamespaceMapping map[string]string `json:"namespace_mapping"`
+	// kind id -> fields dropped before diffing, kinds not listed keep default rules
+	IgnoreRules map[string][]diff.IgnoreRule `json:"ignore_rules"`
+	// cluster name -> hostname rewrites ("*.stage.example.com" -> "*.example.com")
+	HostnameRewrites map[string][]diff.HostnameRewrite `json:"hostname_rewrites"`
+	// directory with snapshots shown in the cluster picker, ./snapshots by default
+	SnapshotDir string `json:"snapshot_dir"`
+	// name -> directory of manifests (desired state from git) shown in the cluster picker
+	ManifestDirs map[string]string `json:"manifest_dirs"`
+	// cluster (kubeconfig context) -> settings of the cluster, e.g. helm storage driver
+	Clusters map[string]k8s.ClusterSettings `json:"clusters"`
+	// key of HMAC fingerprints of Secret values, plain sha256 when empty
+	SecretFingerprintKey string `json:"secret_fingerprint_key"`
 }
 
 func checkAuthentication(next http.Handler) http.Handler {
@@ -46,6 +76,13 @@ func checkAuthentication(next http.Handler) http.Handler {
 		session, _ := store.Get(r, "compare-app") // Replace with your session name
 		token := session.Values["token"]
 
+		// pipelines call API with "Authorization: Bearer <api_token>" instead of gitlab login,
+		// the token is checked by the API routes themselves (requireAPIToken)
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		if r.URL.Path != "/auth/login" && r.URL.Path != "/auth/callback" && (token == nil || token == "") {
 			http.Redirect(w, r, "/auth/login", http.StatusSeeOther)
 			return
@@ -55,6 +92,52 @@ func checkAuthentication(next http.Handler) http.Handler {
 	})
 }
 
+// requireAPIToken lets through only requests with "Authorization: Bearer <api_token>",
+// the API reads clusters with credentials of the server whether gitlab_auth is on or off
+func requireAPIToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || apiToken == "" || subtle.ConstantTimeCompare([]byte(bearer), []byte(apiToken)) != 1 {
+			w.Header().Set("Content-Type", "application/json")
+			http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// registerRoutes adds application pages, the same for both auth and no auth modes
+func registerRoutes(r *mux.Router, sessions *state.Store) {
+	r.HandleFunc("/", handlers.WithSession(sessions, handlers.IndexHandler))
+	r.HandleFunc("/select_config", handlers.WithSession(sessions, handlers.SelectConfigHandler))
+	r.HandleFunc("/clear/selected/cluster/config/connections", handlers.WithSession(sessions, handlers.ClearSelectHandler))
+	r.HandleFunc("/namespaces", handlers.WithSession(sessions, handlers.NamespaceHandler))
+	r.HandleFunc("/resources", handlers.WithSession(sessions, handlers.ResourceHandler))
+	r.HandleFunc("/compare_cluster", handlers.WithSession(sessions, handlers.CompareClusterHandler))
+	r.HandleFunc("/compare_cluster/kind/{kind}", handlers.WithSession(sessions, handlers.CompareKindHandler))
+	r.HandleFunc("/compare_cluster/json/{kind}", handlers.WithSession(sessions, handlers.DisplayJSONHandler))
+	r.HandleFunc("/compare_matrix", handlers.WithSession(sessions, handlers.CompareMatrixHandler))
+	r.HandleFunc("/compare_matrix/{kind}", handlers.WithSession(sessions, handlers.CompareMatrixHandler))
+	r.HandleFunc("/helm/history/{release}", handlers.WithSession(sessions, handlers.HelmHistoryHandler))
+	r.HandleFunc("/helm/history/{release}/diff", handlers.WithSession(sessions, handlers.HelmRevisionDiffHandler))
+
+	// JSON API for pipelines, it does not use comparison sessions and is not
+	// started without api_token
+	if apiToken == "" {
+		log.Println("JSON API /api/v1 is disabled: api_token is not set")
+		return
+	}
+	api := r.PathPrefix("/api/v1").Subrouter()
+	api.Use(requireAPIToken)
+	api.HandleFunc("/clusters", handlers.APIClustersHandler).Methods(http.MethodGet)
+	api.HandleFunc("/clusters/{cluster}/namespaces", handlers.APINamespacesHandler).Methods(http.MethodGet)
+	api.HandleFunc("/kinds", handlers.APIKindsHandler).Methods(http.MethodGet)
+	api.HandleFunc("/compare", handlers.APICompareHandler).Methods(http.MethodPost)
+	api.HandleFunc("/matrix", handlers.APIMatrixHandler).Methods(http.MethodPost)
+	api.HandleFunc("/snapshots", handlers.APISnapshotsHandler).Methods(http.MethodGet)
+	api.HandleFunc("/snapshots", handlers.APICaptureSnapshotHandler).Methods(http.MethodPost)
+}
+
 func isGroupAllowed(groups []string) bool {
 	allowedGroups := []string{gitAllowedGroup}
 	for _, group := range groups {
@@ -69,6 +152,11 @@ func isGroupAllowed(groups []string) bool {
 
 func main() {
 
+	// headless mode for CI: compareapp diff ...
+	if cli.IsCommand(os.Args[1:]) {
+		os.Exit(cli.Run(os.Args[1:], os.Stdout, os.Stderr))
+	}
+
 	// Read the configuration file
 	configApp, err := os.ReadFile("./conf/config.json")
 	if err != nil {
@@ -87,8 +175,37 @@ func main() {
 	redirectURL = config.GitlabCallBackUrl
 	gitlabTokenTime = config.GitlabTokenLife
 	gitAllowedGroup = config.GitlabAllowedGroup
+	apiToken = config.APIToken
 	gitlabAuth := config.GitLabAuth
 
+	k8s.SetClientSettings(k8s.ClientSettings{
+		QPS:         config.KubeQPS,
+		Burst:       config.KubeBurst,
+		Timeout:     time.Duration(config.KubeTimeout) * time.Second,
+		Parallelism: config.KubeParallelism,
+	})
+	diff.SetNamespaceMapping(config.NamespaceMapping)
+	diff.SetSecretKey(config.SecretFingerprintKey)
+	if err := diff.SetIgnoreRules(config.IgnoreRules); err != nil {
+		panic(err)
+	}
+	if err := diff.SetHostnameRewrites(config.HostnameRewrites); err != nil {
+		panic(err)
+	}
+	k8s.SetSnapshotDir(config.SnapshotDir)
+	k8s.SetManifestDirs(config.ManifestDirs)
+	if err := k8s.SetClusterSettings(config.Clusters); err != nil {
+		panic(err)
+	}
+
+	// comparison sessions (selected clusters, namespaces etc.) are kept per user on the server side
+	sessionTTL := config.CompareSessionTTL
+	if sessionTTL <= 0 {
+		sessionTTL = 60
+	}
+	compareSessions := state.NewStore(store, "compare-app", time.Duration(sessionTTL)*time.Minute)
+	compareSessions.StartCleanup(time.Minute)
+
 	if gitlabAuth == true {
 		// Create a custom HTTP client to ignore SSL verification
 		tr := &http.Transport{
@@ -193,25 +310,14 @@ func main() {
 				return
 			}
 
+			compareSessions.Delete(r)     // drop selected clusters and uploaded configs of the user
 			session.Values["token"] = nil // delete session token, when logout action
 			session.Save(r, w)
 
 			http.Redirect(w, r, "/", http.StatusSeeOther) // redirect to login page
 		})
 
-		r.HandleFunc("/", handlers.IndexHandler)
-		r.HandleFunc("/select_config", handlers.SelectConfigHandler)
-		r.HandleFunc("/clear/selected/cluster/config/connections", handlers.ClearSelectHandler)
-		r.HandleFunc("/namespaces", handlers.NamespaceHandler)
-		r.HandleFunc("/resources", handlers.ResourceHandler)
-		r.HandleFunc("/compare_cluster", handlers.CompareClusterHandler)
-		r.HandleFunc("/compare_cluster/canary_json", handlers.DisplayCanaryJSONHandler)
-		r.HandleFunc("/compare_cluster/mettempl", handlers.CompareClusterCMTHandler)
-		r.HandleFunc("/compare_cluster/deploy_json", handlers.DisplayDeployJSONHandler)
-		r.HandleFunc("/compare_cluster/dmnset_json", handlers.DisplayDmnSetJSONHandler)
-		r.HandleFunc("/compare_cluster/services_json", handlers.DisplaySvsJSONHandler)
-		r.HandleFunc("/compare_cluster/tingress_json", handlers.DisplayTingJSONHandler)
-		r.HandleFunc("/compare_cluster/helmvalues_json", handlers.DisplayHelmJSONHandler)
+		registerRoutes(r, compareSessions)
 
 		fmt.Println("Listening on port", config.AppPort)
 		port := ":" + strconv.Itoa(config.AppPort)
@@ -222,19 +328,7 @@ func main() {
 
 	} else {
 		r := mux.NewRouter()
-		r.HandleFunc("/", handlers.IndexHandler)
-		r.HandleFunc("/select_config", handlers.SelectConfigHandler)
-		r.HandleFunc("/clear/selected/cluster/config/connections", handlers.ClearSelectHandler)
-		r.HandleFunc("/namespaces", handlers.NamespaceHandler)
-		r.HandleFunc("/resources", handlers.ResourceHandler)
-		r.HandleFunc("/compare_cluster", handlers.CompareClusterHandler)
-		r.HandleFunc("/compare_cluster/canary_json", handlers.DisplayCanaryJSONHandler)
-		r.HandleFunc("/compare_cluster/mettempl", handlers.CompareClusterCMTHandler)
-		r.HandleFunc("/compare_cluster/deploy_json", handlers.DisplayDeployJSONHandler)
-		r.HandleFunc("/compare_cluster/dmnset_json", handlers.DisplayDmnSetJSONHandler)
-		r.HandleFunc("/compare_cluster/services_json", handlers.DisplaySvsJSONHandler)
-		r.HandleFunc("/compare_cluster/tingress_json", handlers.DisplayTingJSONHandler)
-		r.HandleFunc("/compare_cluster/helmvalues_json", handlers.DisplayHelmJSONHandler)
+		registerRoutes(r, compareSessions)
 
 		fmt.Println("Listening on port", config.AppPort)
 		port := ":" + strconv.Itoa(config.AppPort)
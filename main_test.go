@@ -0,0 +1,42 @@
+package main
+
+import (
+	"compareapp/state"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
+)
+
+func TestAPIToken(t *testing.T) {
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+		want          int
+	}{
+		{"valid token", "secret", "Bearer secret", http.StatusOK},
+		{"wrong token", "secret", "Bearer other", http.StatusUnauthorized},
+		{"no header", "secret", "", http.StatusUnauthorized},
+		{"token without bearer", "secret", "secret", http.StatusUnauthorized},
+		{"api disabled", "", "Bearer ", http.StatusNotFound},
+	}
+	defer func(token string) { apiToken = token }(apiToken)
+	for _, tt := range tests {
+		apiToken = tt.token
+		r := mux.NewRouter()
+		registerRoutes(r, state.NewStore(sessions.NewCookieStore([]byte("test")), "test", 0))
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/kinds", nil)
+		if tt.authorization != "" {
+			req.Header.Set("Authorization", tt.authorization)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+}
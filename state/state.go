@@ -0,0 +1,246 @@
+package state
+
+import (
+	"compareapp/diff"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// cookie value key with the id of the server side comparison session
+const sessionIDKey = "compare_session_id"
+
+// Selection is everything one user selected while walking through the
+// select_config -> namespaces -> resources -> compare_cluster pages. Handlers get
+// a copy of it (see Session.Selection), so cluster calls run without the session lock.
+type Selection struct {
+	ConfigType  string
+	ConfigPaths map[string]string
+	Cluster1    string
+	Cluster2    string
+	Kubeconfig1 string
+	Kubeconfig2 string
+	// ExtraClusters are compared with Cluster1 and Cluster2 on the matrix page
+	// (dev -> stage -> prod), their namespaces are Namespace2 of every pair
+	ExtraClusters   []string
+	Namespaces1     []string
+	Namespaces2     []string
+	Namespace1      string
+	Namespace2      string
+	NamespacePairs  []diff.NamespacePair
+	Resources       []string
+	ClusterVersion1 string
+	ClusterVersion2 string
+	Compare         string
+}
+
+// Sides returns comparison sides of the selected clusters for the namespace pair
+func (sel Selection) Sides(pair diff.NamespacePair) (diff.Side, diff.Side) {
+	return pair.Sides(sel.Cluster1, sel.Kubeconfig1, sel.Cluster2, sel.Kubeconfig2)
+}
+
+// SidePairs returns comparison sides of all selected namespace pairs
+func (sel Selection) SidePairs() [][2]diff.Side {
+	pairs := make([][2]diff.Side, 0, len(sel.NamespacePairs))
+	for _, pair := range sel.NamespacePairs {
+		side1, side2 := sel.Sides(pair)
+		pairs = append(pairs, [2]diff.Side{side1, side2})
+	}
+	return pairs
+}
+
+// Clusters returns all selected clusters, columns of the matrix page
+func (sel Selection) Clusters() []string {
+	return append([]string{sel.Cluster1, sel.Cluster2}, sel.ExtraClusters...)
+}
+
+// MatrixGroups returns sides of all selected clusters for every namespace pair
+func (sel Selection) MatrixGroups() [][]diff.Side {
+	groups := make([][]diff.Side, 0, len(sel.NamespacePairs))
+	for _, pair := range sel.NamespacePairs {
+		side1, side2 := sel.Sides(pair)
+		group := []diff.Side{side1, side2}
+		for _, cluster := range sel.ExtraClusters {
+			group = append(group, diff.Side{Cluster: cluster, Kubeconfig: sel.ConfigPaths[cluster], Namespace: pair.Namespace2})
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// Session is the comparison session of one user. The selection is read and
+// changed under the session lock only for a moment, two tabs of the same user
+// don't wait for each other's comparisons.
+type Session struct {
+	ID string
+
+	mu        sync.Mutex
+	selection Selection
+	cleanups  []func()
+
+	// lastSeen and active are read and written under the lock of the store only
+	lastSeen time.Time
+	active   int
+}
+
+// Selection returns a copy of the current selection. Slices and maps of the copy
+// are replaced, not changed, by Update, so the copy can be read without the lock.
+func (s *Session) Selection() Selection {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.selection
+}
+
+// Update changes the selection under the session lock, f must not call the clusters
+func (s *Session) Update(f func(sel *Selection)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f(&s.selection)
+}
+
+// OnReset registers a function which is called when the selection of the session
+// is reset or the session is expired/deleted (used for wiping uploaded data).
+func (s *Session) OnReset(f func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cleanups = append(s.cleanups, f)
+}
+
+// Reset clears the selection of the session, the session id stays the same.
+// lastSeen is guarded by the store lock and is not touched here.
+func (s *Session) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range s.cleanups {
+		f()
+	}
+	s.selection = Selection{}
+	s.cleanups = nil
+}
+
+// Store keeps comparison sessions in memory, only the session id is sent to the
+// browser inside the gorilla cookie.
+type Store struct {
+	cookies    *sessions.CookieStore
+	cookieName string
+	ttl        time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+func NewStore(cookies *sessions.CookieStore, cookieName string, ttl time.Duration) *Store {
+	return &Store{
+		cookies:    cookies,
+		cookieName: cookieName,
+		ttl:        ttl,
+		sessions:   make(map[string]*Session),
+	}
+}
+
+// Get returns the comparison session of the request, a new one is created (and
+// its id saved to the cookie) when there is no session or it is already expired.
+// The session is in use until Release is called.
+func (st *Store) Get(w http.ResponseWriter, r *http.Request) (*Session, error) {
+	cookie, err := st.cookies.Get(r, st.cookieName)
+	if err != nil {
+		// broken or outdated cookie, gorilla still returns new empty session
+		log.Println("Failed to decode session cookie, new session will be created:", err)
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if id, ok := cookie.Values[sessionIDKey].(string); ok {
+		if s, ok := st.sessions[id]; ok && time.Since(s.lastSeen) < st.ttl {
+			s.lastSeen = time.Now()
+			s.active++
+			return s, nil
+		}
+	}
+
+	id, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+	s := &Session{ID: id, lastSeen: time.Now(), active: 1}
+	st.sessions[id] = s
+
+	cookie.Values[sessionIDKey] = id
+	if err := cookie.Save(r, w); err != nil {
+		delete(st.sessions, id)
+		return nil, err
+	}
+	return s, nil
+}
+
+// Release marks the end of the request, the session expires ttl after the last
+// request is finished, long comparisons don't lose their session on the way.
+func (st *Store) Release(s *Session) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	s.active--
+	s.lastSeen = time.Now()
+}
+
+// Delete drops the comparison session of the request, the cookie itself must be
+// saved by the caller (logout handler does it anyway).
+func (st *Store) Delete(r *http.Request) {
+	cookie, _ := st.cookies.Get(r, st.cookieName)
+	id, ok := cookie.Values[sessionIDKey].(string)
+	if !ok {
+		return
+	}
+	delete(cookie.Values, sessionIDKey)
+
+	st.mu.Lock()
+	s, ok := st.sessions[id]
+	delete(st.sessions, id)
+	st.mu.Unlock()
+	if ok {
+		s.Reset()
+	}
+}
+
+// Cleanup removes expired sessions and returns how many were removed
+func (st *Store) Cleanup() int {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	removed := 0
+	for id, s := range st.sessions {
+		// session of a running request is in use, it is removed on a later run
+		if s.active == 0 && time.Since(s.lastSeen) >= st.ttl {
+			s.Reset()
+			delete(st.sessions, id)
+			removed++
+		}
+	}
+	return removed
+}
+
+// StartCleanup runs Cleanup every interval in background
+func (st *Store) StartCleanup(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if n := st.Cleanup(); n > 0 {
+				log.Println("Expired comparison sessions removed:", n)
+			}
+		}
+	}()
+}
+
+func newSessionID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}